@@ -0,0 +1,434 @@
+package stash
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// AccessReportOptions controls BuildAccessReport.  The zero value reports on every repository of the project
+	// using global, project and repository permissions, the project's default permission, public access and
+	// branch restrictions.
+	AccessReportOptions struct {
+		// Repositories, if not empty, limits the report to the repositories with these slugs.
+		Repositories []string
+		// SkipGlobalPermissions leaves out users and groups with the ADMIN or SYS_ADMIN global permission, which
+		// administer every repository.  Listing global permissions requires ADMIN, so a report built without it
+		// must skip them and then under-states who has access.
+		SkipGlobalPermissions bool
+		// RefRestrictions also applies branch permissions 2.0, which can allow merging a pull request into a
+		// branch that cannot be pushed to directly.  Restrictions matched by branching model are not applied.
+		RefRestrictions bool
+	}
+
+	// AccessReport is the effective access of every user to every branch of a project's repositories.
+	AccessReport struct {
+		ProjectKey   string             `json:"projectKey"`
+		Repositories []RepositoryAccess `json:"repositories"`
+	}
+
+	RepositoryAccess struct {
+		Slug     string         `json:"slug"`
+		Branches []BranchAccess `json:"branches"`
+	}
+
+	BranchAccess struct {
+		Branch string       `json:"branch"`
+		Users  []UserAccess `json:"users"`
+	}
+
+	// UserAccess is the effective access of a user to a branch.  User is AnonymousUser for public access.  Permission is the strongest permission the user
+	// holds on the repository and Via lists where each permission comes from, e.g. "project group
+	// developers PROJECT_WRITE".  Write is direct push access and Merge is the right to merge a pull request into the branch.
+	UserAccess struct {
+		User       string     `json:"user"`
+		Permission Permission `json:"permission"`
+		Read       bool       `json:"read"`
+		Write      bool       `json:"write"`
+		Merge      bool       `json:"merge"`
+		Via        []string   `json:"via"`
+	}
+
+	// grant is a permission held by a user, directly or through a group.
+	grant struct {
+		permission Permission
+		via        string
+	}
+
+	// branchRule restricts pushing to, or merging into, the branches it matches to the users and groups exempt
+	// from it.
+	branchRule struct {
+		matches      func(branch Branch) bool
+		blocksPush   bool
+		blocksMerge  bool
+		exemptUsers  map[string]bool
+		exemptGroups []string
+	}
+)
+
+// AnonymousUser stands for users who are not logged in in the access report of a public project or repository.
+const AnonymousUser = "(anonymous)"
+
+var permissionRank = map[Permission]int{
+	PermissionRepoRead:     1,
+	PermissionProjectRead:  1,
+	PermissionRepoWrite:    2,
+	PermissionProjectWrite: 2,
+	PermissionRepoAdmin:    3,
+	PermissionProjectAdmin: 3,
+	PermissionAdmin:        3,
+	PermissionSysAdmin:     3,
+}
+
+// BuildAccessReport combines the project's permissions, the permissions of each repository, group memberships and
+// branch restrictions into the effective read, write and merge access of each user to each branch.  Users and
+// groups that only appear as exempt from a branch restriction gain no access from it.
+func BuildAccessReport(client Stash, projectKey string, options AccessReportOptions) (AccessReport, error) {
+	report := AccessReport{ProjectKey: projectKey, Repositories: make([]RepositoryAccess, 0)}
+
+	repositories, err := reportRepositories(client, projectKey, options.Repositories)
+	if err != nil {
+		return report, err
+	}
+
+	members := make(map[string][]User)
+	groupMembers := func(group string) ([]User, error) {
+		if users, ok := members[group]; ok {
+			return users, nil
+		}
+		users, err := client.GetGroupMembers(group)
+		if err != nil {
+			return nil, err
+		}
+		members[group] = users
+		return users, nil
+	}
+
+	inherited := make(map[string][]grant)
+	if !options.SkipGlobalPermissions {
+		users, err := client.GetGlobalUserPermissions()
+		if err != nil {
+			return report, err
+		}
+		groups, err := client.GetGlobalGroupPermissions()
+		if err != nil {
+			return report, err
+		}
+		if err := addGrants(inherited, "global", users, groups, groupMembers); err != nil {
+			return report, err
+		}
+	}
+	users, err := client.GetUserPermissions(projectKey, "")
+	if err != nil {
+		return report, err
+	}
+	groups, err := client.GetGroupPermissions(projectKey, "")
+	if err != nil {
+		return report, err
+	}
+	if err := addGrants(inherited, "project", users, groups, groupMembers); err != nil {
+		return report, err
+	}
+	defaultPermission, err := client.GetProjectDefaultPermission(projectKey)
+	if err != nil {
+		return report, err
+	}
+	if defaultPermission != "" {
+		licensed, err := client.GetUsers(UserListOptions{Permission: PermissionLicensedUser})
+		if err != nil {
+			return report, err
+		}
+		for _, user := range licensed {
+			inherited[user.Name] = append(inherited[user.Name], grant{permission: defaultPermission, via: fmt.Sprintf("project default %s", defaultPermission)})
+		}
+	}
+
+	for _, repository := range repositories {
+		slug := repository.Slug
+		grants := make(map[string][]grant)
+		for user, g := range inherited {
+			grants[user] = append(grants[user], g...)
+		}
+		if repository.Project.Public {
+			grants[AnonymousUser] = append(grants[AnonymousUser], grant{permission: PermissionProjectRead, via: "project public access"})
+		}
+		if repository.Public {
+			grants[AnonymousUser] = append(grants[AnonymousUser], grant{permission: PermissionRepoRead, via: "repository public access"})
+		}
+		users, err := client.GetUserPermissions(projectKey, slug)
+		if err != nil {
+			return report, err
+		}
+		groups, err := client.GetGroupPermissions(projectKey, slug)
+		if err != nil {
+			return report, err
+		}
+		if err := addGrants(grants, "repository", users, groups, groupMembers); err != nil {
+			return report, err
+		}
+
+		rules, err := branchRules(client, projectKey, slug, options.RefRestrictions)
+		if err != nil {
+			return report, err
+		}
+		branches, err := client.GetBranches(projectKey, slug)
+		if err != nil {
+			return report, err
+		}
+
+		branchNames := make([]string, 0, len(branches))
+		for name := range branches {
+			branchNames = append(branchNames, name)
+		}
+		sort.Strings(branchNames)
+		userNames := make([]string, 0, len(grants))
+		for user := range grants {
+			userNames = append(userNames, user)
+		}
+		sort.Strings(userNames)
+
+		repositoryAccess := RepositoryAccess{Slug: slug, Branches: make([]BranchAccess, 0, len(branches))}
+		for _, name := range branchNames {
+			branch := branches[name]
+			access := BranchAccess{Branch: branch.DisplayID, Users: make([]UserAccess, 0, len(userNames))}
+			for _, user := range userNames {
+				userAccess, err := effectiveAccess(user, grants[user], branch, rules, groupMembers)
+				if err != nil {
+					return report, err
+				}
+				access.Users = append(access.Users, userAccess)
+			}
+			repositoryAccess.Branches = append(repositoryAccess.Branches, access)
+		}
+		report.Repositories = append(report.Repositories, repositoryAccess)
+	}
+	return report, nil
+}
+
+// WriteJSON writes the report as indented JSON.
+func (report AccessReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteCSV writes the report as CSV with a header row and one row per repository, branch and user.
+func (report AccessReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"project", "repository", "branch", "user", "permission", "read", "write", "merge", "via"}); err != nil {
+		return err
+	}
+	for _, repository := range report.Repositories {
+		for _, branch := range repository.Branches {
+			for _, user := range branch.Users {
+				row := []string{
+					report.ProjectKey,
+					repository.Slug,
+					branch.Branch,
+					user.User,
+					string(user.Permission),
+					fmt.Sprintf("%t", user.Read),
+					fmt.Sprintf("%t", user.Write),
+					fmt.Sprintf("%t", user.Merge),
+					strings.Join(user.Via, "; "),
+				}
+				if err := out.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// reportRepositories returns the repositories of the project, sorted by slug, limited to the given slugs if any.
+func reportRepositories(client Stash, projectKey string, only []string) ([]Repository, error) {
+	repositories, err := client.GetProjectRepositories(projectKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(only) > 0 {
+		bySlug := make(map[string]Repository, len(repositories))
+		for _, repository := range repositories {
+			bySlug[repository.Slug] = repository
+		}
+		repositories = make([]Repository, 0, len(only))
+		for _, slug := range only {
+			repository, ok := bySlug[slug]
+			if !ok {
+				return nil, fmt.Errorf("stash: repository %s is not in project %s", slug, projectKey)
+			}
+			repositories = append(repositories, repository)
+		}
+	}
+	sort.Slice(repositories, func(i, j int) bool { return repositories[i].Slug < repositories[j].Slug })
+	return repositories, nil
+}
+
+// addGrants records the permissions that give access to repositories; LICENSED_USER and the like are skipped.
+func addGrants(grants map[string][]grant, scope string, users []UserPermission, groups []GroupPermission, groupMembers func(string) ([]User, error)) error {
+	for _, p := range users {
+		if permissionRank[p.Permission] == 0 {
+			continue
+		}
+		grants[p.User.Name] = append(grants[p.User.Name], grant{permission: p.Permission, via: fmt.Sprintf("%s user %s", scope, p.Permission)})
+	}
+	for _, p := range groups {
+		if permissionRank[p.Permission] == 0 {
+			continue
+		}
+		members, err := groupMembers(p.Group.Name)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			grants[member.Name] = append(grants[member.Name], grant{permission: p.Permission, via: fmt.Sprintf("%s group %s %s", scope, p.Group.Name, p.Permission)})
+		}
+	}
+	return nil
+}
+
+func effectiveAccess(user string, grants []grant, branch Branch, rules []branchRule, groupMembers func(string) ([]User, error)) (UserAccess, error) {
+	access := UserAccess{User: user, Via: make([]string, 0, len(grants))}
+	rank := 0
+	for _, g := range grants {
+		if permissionRank[g.permission] > rank {
+			rank = permissionRank[g.permission]
+			access.Permission = g.permission
+		}
+		access.Via = append(access.Via, g.via)
+	}
+	access.Read = rank >= 1
+	access.Write = rank >= 2
+	access.Merge = rank >= 2
+
+	for _, rule := range rules {
+		if !(access.Write || access.Merge) || !rule.matches(branch) {
+			continue
+		}
+		exempt, err := rule.exempts(user, groupMembers)
+		if err != nil {
+			return access, err
+		}
+		if exempt {
+			continue
+		}
+		if rule.blocksPush {
+			access.Write = false
+		}
+		if rule.blocksMerge {
+			access.Merge = false
+		}
+	}
+	return access, nil
+}
+
+func (rule branchRule) exempts(user string, groupMembers func(string) ([]User, error)) (bool, error) {
+	if rule.exemptUsers[user] {
+		return true, nil
+	}
+	for _, group := range rule.exemptGroups {
+		members, err := groupMembers(group)
+		if err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			if member.Name == user {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// branchRules returns the branch restrictions of a repository, and with refRestrictions set, the branch
+// permissions 2.0 of the repository and its project.  A branch restriction lets only its users and groups push to
+// or merge into the branch.
+func branchRules(client Stash, projectKey, repositorySlug string, refRestrictions bool) ([]branchRule, error) {
+	rules := make([]branchRule, 0)
+
+	restrictions, err := client.GetBranchRestrictions(projectKey, repositorySlug)
+	if err != nil {
+		return nil, err
+	}
+	for _, restriction := range restrictions.BranchRestriction {
+		rule := branchRule{blocksPush: true, blocksMerge: true, exemptUsers: make(map[string]bool), exemptGroups: restriction.Groups}
+		for _, user := range restriction.Users {
+			rule.exemptUsers[user.Name] = true
+		}
+		if restriction.Type == "PATTERN" {
+			rule.matches = patternMatcher(restriction.Value)
+		} else {
+			rule.matches = refMatcher(restriction.Value)
+		}
+		rules = append(rules, rule)
+	}
+
+	if !refRestrictions {
+		return rules, nil
+	}
+	seen := make(map[int]bool)
+	for _, slug := range []string{"", repositorySlug} {
+		restrictions, err := client.GetRefRestrictions(projectKey, slug)
+		if err != nil {
+			return nil, err
+		}
+		for _, restriction := range restrictions {
+			if seen[restriction.ID] {
+				continue
+			}
+			seen[restriction.ID] = true
+
+			rule := branchRule{exemptUsers: make(map[string]bool), exemptGroups: restriction.Groups}
+			switch restriction.Type {
+			case RestrictionReadOnly:
+				rule.blocksPush, rule.blocksMerge = true, true
+			case RestrictionPullRequestOnly:
+				rule.blocksPush = true
+			default:
+				continue
+			}
+			switch restriction.Matcher.Type.ID {
+			case MatcherBranch:
+				rule.matches = refMatcher(restriction.Matcher.ID)
+			case MatcherPattern:
+				rule.matches = patternMatcher(restriction.Matcher.ID)
+			default:
+				continue
+			}
+			for _, user := range restriction.Users {
+				rule.exemptUsers[user.Name] = true
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func refMatcher(ref string) func(Branch) bool {
+	ref = qualifiedBranchRef(ref)
+	return func(branch Branch) bool {
+		return branch.ID == ref
+	}
+}
+
+// patternMatcher matches a branch restriction pattern, in which * matches any run of characters including / and ?
+// matches any one character, against the branch name and its fully qualified ref.
+func patternMatcher(pattern string) func(Branch) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.Replace(expression, `\*`, ".*", -1)
+	expression = strings.Replace(expression, `\?`, ".", -1)
+	re := regexp.MustCompile("^" + expression + "$")
+	return func(branch Branch) bool {
+		return re.MatchString(branch.DisplayID) || re.MatchString(branch.ID)
+	}
+}
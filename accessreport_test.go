@@ -0,0 +1,238 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+var accessReportResponses = map[string]string{
+	"/rest/api/1.0/projects/PROJ/repos": `{"isLastPage": true, "values": [
+		{"id": 1, "slug": "app", "project": {"key": "PROJ"}}]}`,
+	"/rest/api/1.0/admin/permissions/users": `{"isLastPage": true, "values": [
+		{"user": {"name": "root"}, "permission": "SYS_ADMIN"},
+		{"user": {"name": "erin"}, "permission": "LICENSED_USER"}]}`,
+	"/rest/api/1.0/admin/permissions/groups":                    `{"isLastPage": true, "values": []}`,
+	"/rest/api/1.0/projects/PROJ/permissions/PROJECT_WRITE/all": `{"permitted": false}`,
+	"/rest/api/1.0/projects/PROJ/permissions/PROJECT_READ/all":  `{"permitted": false}`,
+	"/rest/api/1.0/projects/PROJ/permissions/users": `{"isLastPage": true, "values": [
+		{"user": {"name": "alice"}, "permission": "PROJECT_ADMIN"}]}`,
+	"/rest/api/1.0/projects/PROJ/permissions/groups": `{"isLastPage": true, "values": [
+		{"group": {"name": "developers"}, "permission": "PROJECT_WRITE"}]}`,
+	"/rest/api/1.0/projects/PROJ/repos/app/permissions/users": `{"isLastPage": true, "values": [
+		{"user": {"name": "dave"}, "permission": "REPO_READ"}]}`,
+	"/rest/api/1.0/projects/PROJ/repos/app/permissions/groups": `{"isLastPage": true, "values": []}`,
+	"/rest/api/1.0/users?group=developers": `{"isLastPage": true, "values": [
+		{"name": "bob"}, {"name": "carol"}]}`,
+	"/rest/api/1.0/users?group=release-managers": `{"isLastPage": true, "values": [
+		{"name": "carol"}]}`,
+	"/rest/branch-permissions/1.0/projects/PROJ/repos/app/restricted": `{"isLastPage": true, "values": [
+		{"id": 1, "type": "BRANCH", "value": "refs/heads/master", "users": [{"name": "alice"}], "groups": []}]}`,
+	"/rest/branch-permissions/2.0/projects/PROJ/restrictions": `{"isLastPage": true, "values": [
+		{"id": 7, "type": "pull-request-only", "matcher": {"id": "release/*", "type": {"id": "PATTERN"}}, "users": [], "groups": ["release-managers"]}]}`,
+	"/rest/branch-permissions/2.0/projects/PROJ/repos/app/restrictions": `{"isLastPage": true, "values": [
+		{"id": 7, "type": "pull-request-only", "matcher": {"id": "release/*", "type": {"id": "PATTERN"}}, "users": [], "groups": ["release-managers"]},
+		{"id": 8, "type": "no-deletes", "matcher": {"id": "refs/heads/develop", "type": {"id": "BRANCH"}}, "users": [], "groups": []}]}`,
+	"/rest/api/1.0/projects/PROJ/repos/app/branches": `{"isLastPage": true, "values": [
+		{"id": "refs/heads/master", "displayId": "master"},
+		{"id": "refs/heads/develop", "displayId": "develop"},
+		{"id": "refs/heads/release/1.0", "displayId": "release/1.0"}]}`,
+}
+
+// accessReportServer serves accessReportResponses, with overrides taking precedence.
+func accessReportServer(t *testing.T, overrides map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if group := r.URL.Query().Get("group"); group != "" {
+			key = key + "?group=" + group
+		}
+		if permission := r.URL.Query().Get("permission"); permission != "" {
+			key = key + "?permission=" + permission
+		}
+		response, ok := overrides[key]
+		if !ok {
+			response, ok = accessReportResponses[key]
+		}
+		if !ok {
+			t.Fatalf("Unexpected request %s\n", r.URL)
+		}
+		fmt.Fprint(w, response)
+	}))
+}
+
+func TestBuildAccessReport(t *testing.T) {
+	testServer := accessReportServer(t, nil)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	report, err := BuildAccessReport(stashClient, "PROJ", AccessReportOptions{RefRestrictions: true})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(report.Repositories) != 1 || report.Repositories[0].Slug != "app" {
+		t.Fatalf("Want only the app repository but got %+v\n", report.Repositories)
+	}
+
+	access := make(map[string]UserAccess)
+	for _, branch := range report.Repositories[0].Branches {
+		for _, user := range branch.Users {
+			access[branch.Branch+" "+user.User] = user
+		}
+	}
+	var tests = []struct {
+		key                string
+		read, write, merge bool
+	}{
+		{"master alice", true, true, true},
+		{"master bob", true, false, false},
+		{"master dave", true, false, false},
+		{"develop bob", true, true, true},
+		{"develop dave", true, false, false},
+		{"release/1.0 alice", true, false, true},
+		{"release/1.0 bob", true, false, true},
+		{"release/1.0 carol", true, true, true},
+		{"release/1.0 root", true, false, true},
+	}
+	for _, test := range tests {
+		got, ok := access[test.key]
+		if !ok {
+			t.Fatalf("Want an entry for %s\n", test.key)
+		}
+		if got.Read != test.read || got.Write != test.write || got.Merge != test.merge {
+			t.Fatalf("%s: want read %t write %t merge %t but got %+v\n", test.key, test.read, test.write, test.merge, got)
+		}
+	}
+	if got := access["develop carol"]; got.Permission != PermissionProjectWrite || len(got.Via) != 1 || got.Via[0] != "project group developers PROJECT_WRITE" {
+		t.Fatalf("Want carol's access via the developers group but got %+v\n", got)
+	}
+	if got := access["develop root"]; got.Permission != PermissionSysAdmin || got.Via[0] != "global user SYS_ADMIN" {
+		t.Fatalf("Want root's access via the global SYS_ADMIN permission but got %+v\n", got)
+	}
+	if len(access) != 15 {
+		t.Fatalf("Want 3 branches by 5 users but got %d entries\n", len(access))
+	}
+}
+
+func TestAccessReportExport(t *testing.T) {
+	testServer := accessReportServer(t, nil)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	report, err := BuildAccessReport(stashClient, "PROJ", AccessReportOptions{Repositories: []string{"app"}})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(rows) != 16 {
+		t.Fatalf("Want a header and 15 rows but got %d\n", len(rows))
+	}
+	if rows[0][0] != "project" || rows[0][8] != "via" {
+		t.Fatalf("Unexpected header %v\n", rows[0])
+	}
+	// branches and users are sorted; without ref restrictions release/1.0 is open to every writer
+	want := []string{"PROJ", "app", "develop", "alice", "PROJECT_ADMIN", "true", "true", "true", "project user PROJECT_ADMIN"}
+	if fmt.Sprint(rows[1]) != fmt.Sprint(want) {
+		t.Fatalf("Want %v but got %v\n", want, rows[1])
+	}
+	if rows[14][2] != "release/1.0" || rows[14][3] != "dave" || rows[14][6] != "false" {
+		t.Fatalf("Want dave unable to write release/1.0 but got %v\n", rows[14])
+	}
+
+	buf.Reset()
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	var decoded AccessReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if decoded.ProjectKey != "PROJ" || len(decoded.Repositories[0].Branches) != 3 || decoded.Repositories[0].Branches[2].Users[1].Write != true {
+		t.Fatalf("Unexpected JSON report %+v\n", decoded)
+	}
+}
+
+func TestAccessReportDefaultAndPublicAccess(t *testing.T) {
+	testServer := accessReportServer(t, map[string]string{
+		"/rest/api/1.0/projects/PROJ/repos": `{"isLastPage": true, "values": [
+			{"id": 1, "slug": "app", "public": true, "project": {"key": "PROJ", "public": true}}]}`,
+		"/rest/api/1.0/projects/PROJ/permissions/PROJECT_READ/all": `{"permitted": true}`,
+		"/rest/api/1.0/users?permission=LICENSED_USER": `{"isLastPage": true, "values": [
+			{"name": "erin"}, {"name": "dave"}]}`,
+	})
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	report, err := BuildAccessReport(stashClient, "PROJ", AccessReportOptions{SkipGlobalPermissions: true})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+
+	access := make(map[string]UserAccess)
+	for _, user := range report.Repositories[0].Branches[0].Users {
+		access[user.User] = user
+	}
+	if _, ok := access["root"]; ok {
+		t.Fatalf("Want global permissions skipped but got %+v\n", access["root"])
+	}
+	if got := access["erin"]; !got.Read || got.Write || got.Via[0] != "project default PROJECT_READ" {
+		t.Fatalf("Want erin reading through the default permission but got %+v\n", got)
+	}
+	if got := access["dave"]; got.Permission != PermissionProjectRead || len(got.Via) != 2 {
+		t.Fatalf("Want dave's default and repository grants but got %+v\n", got)
+	}
+	got := access[AnonymousUser]
+	if !got.Read || got.Write || got.Merge || fmt.Sprint(got.Via) != "[project public access repository public access]" {
+		t.Fatalf("Want anonymous read access but got %+v\n", got)
+	}
+}
+
+func TestAccessReportUnknownRepository(t *testing.T) {
+	testServer := accessReportServer(t, nil)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := BuildAccessReport(stashClient, "PROJ", AccessReportOptions{Repositories: []string{"nope"}}); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestPatternMatcher(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		branch  string
+		want    bool
+	}{
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", true},
+		{"release/*", "releases", false},
+		{"*-stable", "2.x-stable", true},
+		{"refs/heads/feature/*", "feature/x", true},
+		{"master", "master", true},
+		{"master", "master2", false},
+		{"release/?.x", "release/2.x", true},
+		{"release/?.x", "release/10.x", false},
+	}
+	for _, test := range tests {
+		branch := Branch{ID: "refs/heads/" + test.branch, DisplayID: test.branch}
+		if got := patternMatcher(test.pattern)(branch); got != test.want {
+			t.Fatalf("%s matching %s: want %t but got %t\n", test.pattern, test.branch, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// HTTP access tokens.  A token belongs to a user, a project or a repository; see TokenOwner.
+
+type (
+	// TokenOwner is the user, project or repository that access tokens belong to.  Build one with
+	// UserTokenOwner, ProjectTokenOwner or RepositoryTokenOwner.
+	TokenOwner struct {
+		UserSlug       string
+		ProjectKey     string
+		RepositorySlug string
+	}
+
+	AccessTokens struct {
+		Page
+		AccessTokens []AccessToken `json:"values"`
+	}
+
+	// AccessToken describes an access token.  Its secret is only available from CreateAccessToken.  ExpiryDate and
+	// LastAuthenticated are zero if the token never expires or has never been used.
+	AccessToken struct {
+		ID                string       `json:"id"`
+		Name              string       `json:"name"`
+		Permissions       []Permission `json:"permissions"`
+		CreatedDate       int64        `json:"createdDate"`
+		ExpiryDate        int64        `json:"expiryDate"`
+		ExpiryDays        int          `json:"expiryDays"`
+		LastAuthenticated int64        `json:"lastAuthenticated"`
+		User              User         `json:"user"`
+	}
+
+	// AccessTokenRequest describes a token to create or update.  Permissions are e.g. REPO_READ and PROJECT_WRITE.
+	// ExpiryDays is only used on creation; zero means the token does not expire, unless the server requires it to.
+	AccessTokenRequest struct {
+		Name        string       `json:"name,omitempty"`
+		Permissions []Permission `json:"permissions,omitempty"`
+		ExpiryDays  int          `json:"expiryDays,omitempty"`
+	}
+
+	// NewAccessToken is a token just created, with its secret.
+	NewAccessToken struct {
+		AccessToken
+		Secret TokenSecret
+	}
+
+	// TokenSecret holds a token secret.  It prints and marshals as "[redacted]" so that it does not end up in
+	// logs by accident; call Reveal to use it.
+	TokenSecret struct {
+		secret string
+	}
+)
+
+const redacted = "[redacted]"
+
+// UserTokenOwner returns the owner of the access tokens of the user with the given slug.
+func UserTokenOwner(userSlug string) TokenOwner {
+	return TokenOwner{UserSlug: userSlug}
+}
+
+// ProjectTokenOwner returns the owner of the access tokens of a project.
+func ProjectTokenOwner(projectKey string) TokenOwner {
+	return TokenOwner{ProjectKey: projectKey}
+}
+
+// RepositoryTokenOwner returns the owner of the access tokens of a repository.
+func RepositoryTokenOwner(projectKey, repositorySlug string) TokenOwner {
+	return TokenOwner{ProjectKey: projectKey, RepositorySlug: repositorySlug}
+}
+
+// Reveal returns the secret, e.g. to use as a bearer token or to store in a vault.
+func (secret TokenSecret) Reveal() string {
+	return secret.secret
+}
+
+func (secret TokenSecret) String() string {
+	return redacted
+}
+
+func (secret TokenSecret) GoString() string {
+	return redacted
+}
+
+func (secret TokenSecret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+func (secret TokenSecret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// ExpiryTime returns when the token expires, or the zero time if it does not.
+func (token AccessToken) ExpiryTime() time.Time {
+	if token.ExpiryDate == 0 {
+		return time.Time{}
+	}
+	return millisToTime(token.ExpiryDate)
+}
+
+// CreateAccessToken creates an access token and returns it with its secret, which Stash does not return again.
+func (client Client) CreateAccessToken(owner TokenOwner, token AccessTokenRequest) (NewAccessToken, error) {
+	if token.Name == "" {
+		return NewAccessToken{}, fmt.Errorf("stash: an access token needs a name")
+	}
+	if len(token.Permissions) == 0 {
+		return NewAccessToken{}, fmt.Errorf("stash: access token %s needs at least one permission", token.Name)
+	}
+	if token.ExpiryDays < 0 {
+		return NewAccessToken{}, fmt.Errorf("stash: access token %s has negative expiry days", token.Name)
+	}
+	tokensURL, err := client.accessTokensURL(owner)
+	if err != nil {
+		return NewAccessToken{}, err
+	}
+
+	data, err := client.sendAccessToken("CreateAccessToken", "PUT", tokensURL, token)
+	if err != nil {
+		return NewAccessToken{}, err
+	}
+	var t struct {
+		AccessToken
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return NewAccessToken{}, err
+	}
+	return NewAccessToken{AccessToken: t.AccessToken, Secret: TokenSecret{secret: t.Token}}, nil
+}
+
+// UpdateAccessToken changes the name and permissions of an access token.  Empty fields are left unchanged.
+func (client Client) UpdateAccessToken(owner TokenOwner, tokenID string, token AccessTokenRequest) (AccessToken, error) {
+	tokensURL, err := client.accessTokensURL(owner)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	token.ExpiryDays = 0
+	data, err := client.sendAccessToken("UpdateAccessToken", "POST", fmt.Sprintf("%s/%s", tokensURL, url.PathEscape(tokenID)), token)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	var t AccessToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return AccessToken{}, err
+	}
+	return t, nil
+}
+
+// GetAccessTokens returns the access tokens of the owner, without their secrets.
+func (client Client) GetAccessTokens(owner TokenOwner) ([]AccessToken, error) {
+	tokensURL, err := client.accessTokensURL(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	tokens := make([]AccessToken, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s?start=%d&limit=%d", tokensURL, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetAccessTokens %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r AccessTokens
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, r.AccessTokens...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return tokens, nil
+}
+
+// GetAccessToken returns the access token with the given id, without its secret.
+func (client Client) GetAccessToken(owner TokenOwner, tokenID string) (AccessToken, error) {
+	tokensURL, err := client.accessTokensURL(owner)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var token AccessToken
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", tokensURL, url.PathEscape(tokenID)), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetAccessToken %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Does the token exist?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &token)
+	}
+
+	return token, retry.Try(work)
+}
+
+// RevokeAccessToken deletes the access token with the given id.
+func (client Client) RevokeAccessToken(owner TokenOwner, tokenID string) error {
+	tokensURL, err := client.accessTokensURL(owner)
+	if err != nil {
+		return err
+	}
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%s", tokensURL, url.PathEscape(tokenID)), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.RevokeAccessToken %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent && responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+func (client Client) sendAccessToken(operation, method, tokenURL string, token AccessTokenRequest) ([]byte, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, tokenURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return nil, err
+	}
+	if responseCode != http.StatusOK && responseCode != http.StatusCreated {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The access token was not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage the access tokens."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the user, project or repo exist?  The token?"
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return nil, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+	return data, nil
+}
+
+func (client Client) accessTokensURL(owner TokenOwner) (string, error) {
+	switch {
+	case owner.UserSlug != "" && owner.ProjectKey == "" && owner.RepositorySlug == "":
+		return fmt.Sprintf("%s/rest/access-tokens/1.0/users/%s", client.baseURL.String(), url.PathEscape(owner.UserSlug)), nil
+	case owner.UserSlug == "" && owner.ProjectKey != "" && owner.RepositorySlug == "":
+		return fmt.Sprintf("%s/rest/access-tokens/1.0/projects/%s", client.baseURL.String(), owner.ProjectKey), nil
+	case owner.UserSlug == "" && owner.ProjectKey != "":
+		return fmt.Sprintf("%s/rest/access-tokens/1.0/projects/%s/repos/%s", client.baseURL.String(), owner.ProjectKey, owner.RepositorySlug), nil
+	}
+	return "", fmt.Errorf("stash: a token owner is a user, a project or a repository: %+v", owner)
+}
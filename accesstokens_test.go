@@ -0,0 +1,185 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const createAccessTokenResponse string = `
+{
+	"id": "123456789012",
+	"name": "ci",
+	"permissions": ["REPO_READ", "PROJECT_READ"],
+	"createdDate": 1420070400000,
+	"expiryDate": 1422662400000,
+	"expiryDays": 30,
+	"user": {"name": "jcitizen", "slug": "jcitizen"},
+	"token": "MDM0MjM5NDc2MDxxxxxxxxxxxxxxxxxxxxxxxx"
+}
+`
+
+func TestCreateAccessToken(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/access-tokens/1.0/users/jcitizen" {
+			t.Fatalf("CreateAccessToken() URL path expected to be /rest/access-tokens/1.0/users/jcitizen but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if string(data) != `{"name":"ci","permissions":["REPO_READ","PROJECT_READ"],"expiryDays":30}` {
+			t.Fatalf("Unexpected request body %s\n", data)
+		}
+		fmt.Fprint(w, createAccessTokenResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	token, err := stashClient.CreateAccessToken(UserTokenOwner("jcitizen"), AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead, PermissionProjectRead}, ExpiryDays: 30})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if token.ID != "123456789012" || len(token.Permissions) != 2 || token.ExpiryTime().Year() != 2015 {
+		t.Fatalf("Unexpected token %+v\n", token.AccessToken)
+	}
+	if token.Secret.Reveal() != "MDM0MjM5NDc2MDxxxxxxxxxxxxxxxxxxxxxxxx" {
+		t.Fatalf("Want the token secret but got %s\n", token.Secret.Reveal())
+	}
+
+	for _, printed := range []string{fmt.Sprintf("%v", token), fmt.Sprintf("%+v", token), fmt.Sprintf("%#v", token), fmt.Sprint(token.Secret)} {
+		if strings.Contains(printed, "MDM0MjM5") {
+			t.Fatalf("Secret leaked by fmt: %s\n", printed)
+		}
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if strings.Contains(string(data), "MDM0MjM5") || !strings.Contains(string(data), `"Secret":"[redacted]"`) {
+		t.Fatalf("Secret leaked by json: %s\n", data)
+	}
+}
+
+func TestCreateAccessTokenValidation(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request for an invalid token\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	var tests = []struct {
+		owner TokenOwner
+		token AccessTokenRequest
+	}{
+		{UserTokenOwner("jcitizen"), AccessTokenRequest{Permissions: []Permission{PermissionRepoRead}}},
+		{UserTokenOwner("jcitizen"), AccessTokenRequest{Name: "ci"}},
+		{UserTokenOwner("jcitizen"), AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead}, ExpiryDays: -1}},
+		{TokenOwner{}, AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead}}},
+		{TokenOwner{UserSlug: "jcitizen", ProjectKey: "PROJ"}, AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead}}},
+		{TokenOwner{UserSlug: "jcitizen", RepositorySlug: "slug"}, AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead}}},
+		{TokenOwner{RepositorySlug: "slug"}, AccessTokenRequest{Name: "ci", Permissions: []Permission{PermissionRepoRead}}},
+	}
+	for _, test := range tests {
+		if _, err := stashClient.CreateAccessToken(test.owner, test.token); err == nil {
+			t.Fatalf("Expecting error for %+v %+v but did not get one\n", test.owner, test.token)
+		}
+	}
+}
+
+func TestGetAccessTokens(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/access-tokens/1.0/projects/PROJ/repos/slug" {
+			t.Fatalf("GetAccessTokens() URL path expected to be /rest/access-tokens/1.0/projects/PROJ/repos/slug but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"id": "1", "name": "deploy", "permissions": ["REPO_WRITE"], "lastAuthenticated": 1420070400000}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	tokens, err := stashClient.GetAccessTokens(RepositoryTokenOwner("PROJ", "slug"))
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "deploy" || tokens[0].Permissions[0] != PermissionRepoWrite {
+		t.Fatalf("Want the deploy token but got %+v\n", tokens)
+	}
+	if !tokens[0].ExpiryTime().IsZero() {
+		t.Fatalf("Want no expiry but got %v\n", tokens[0].ExpiryTime())
+	}
+}
+
+func TestGetAccessToken404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/access-tokens/1.0/projects/PROJ/1" {
+			t.Fatalf("GetAccessToken() URL path expected to be /rest/access-tokens/1.0/projects/PROJ/1 but found %s\n", r.URL.Path)
+		}
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetAccessToken(ProjectTokenOwner("PROJ"), "1"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestUpdateAccessToken(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/access-tokens/1.0/projects/PROJ/1" {
+			t.Fatalf("UpdateAccessToken() URL path expected to be /rest/access-tokens/1.0/projects/PROJ/1 but found %s\n", r.URL.Path)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if string(data) != `{"permissions":["PROJECT_WRITE"]}` {
+			t.Fatalf("Unexpected request body %s\n", data)
+		}
+		fmt.Fprint(w, `{"id": "1", "name": "deploy", "permissions": ["PROJECT_WRITE"]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	token, err := stashClient.UpdateAccessToken(ProjectTokenOwner("PROJ"), "1", AccessTokenRequest{Permissions: []Permission{PermissionProjectWrite}, ExpiryDays: 7})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if token.Permissions[0] != PermissionProjectWrite {
+		t.Fatalf("Want PROJECT_WRITE but got %v\n", token.Permissions)
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/access-tokens/1.0/users/jcitizen/123456789012" {
+			t.Fatalf("RevokeAccessToken() URL path expected to be /rest/access-tokens/1.0/users/jcitizen/123456789012 but found %s\n", r.URL.Path)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.RevokeAccessToken(UserTokenOwner("jcitizen"), "123456789012"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
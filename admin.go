@@ -0,0 +1,264 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	// StashAdmin adds user and group management to Stash.  Every method requires the ADMIN global permission.
+	// Obtain one with NewAdminClient; NewClient deliberately returns the narrower Stash interface.
+	StashAdmin interface {
+		Stash
+		CreateUser(user NewUser) error
+		DeleteUser(userName string) (User, error)
+		RenameUser(userName, newName string) (User, error)
+		SetUserPassword(userName, password string) error
+		AddUserToGroups(userName string, groups []string) error
+		RemoveUserFromGroup(userName, group string) error
+		GetUserGroups(userName string) ([]string, error)
+		CreateGroup(group string) error
+		DeleteGroup(group string) error
+	}
+
+	// NewUser describes a user to create.  Password may be empty only if Notify is set, in which case Stash
+	// emails the user a link to choose one.
+	NewUser struct {
+		Name              string
+		DisplayName       string
+		EmailAddress      string
+		Password          string
+		AddToDefaultGroup bool
+		Notify            bool
+	}
+
+	// adminClient holds the admin methods, so that the Client returned by NewClient does not satisfy StashAdmin.
+	adminClient struct {
+		Client
+	}
+
+	adminGroups struct {
+		Page
+		Groups []adminGroup `json:"values"`
+	}
+
+	adminGroup struct {
+		Name      string `json:"name"`
+		Deletable bool   `json:"deletable"`
+	}
+)
+
+// NewAdminClient returns a client that can also manage users and groups.
+func NewAdminClient(userName, password string, baseURL *url.URL) StashAdmin {
+	return adminClient{Client{userName: userName, password: password, baseURL: baseURL}}
+}
+
+// CreateUser creates a user.
+func (client adminClient) CreateUser(user NewUser) error {
+	if user.Password == "" && !user.Notify {
+		return fmt.Errorf("stash: user %s needs a password unless Notify is set", user.Name)
+	}
+	params := url.Values{}
+	params.Set("name", user.Name)
+	params.Set("displayName", user.DisplayName)
+	params.Set("emailAddress", user.EmailAddress)
+	params.Set("addToDefaultGroup", fmt.Sprintf("%t", user.AddToDefaultGroup))
+	if user.Notify {
+		params.Set("notify", "true")
+	} else {
+		params.Set("password", user.Password)
+	}
+	_, err := client.sendAdmin("CreateUser", "POST", fmt.Sprintf("%s/rest/api/1.0/admin/users?%s", client.baseURL.String(), params.Encode()), nil)
+	return err
+}
+
+// DeleteUser deletes the user and returns it as it was before deletion.
+func (client adminClient) DeleteUser(userName string) (User, error) {
+	params := url.Values{}
+	params.Set("name", userName)
+	data, err := client.sendAdmin("DeleteUser", "DELETE", fmt.Sprintf("%s/rest/api/1.0/admin/users?%s", client.baseURL.String(), params.Encode()), nil)
+	if err != nil {
+		return User{}, err
+	}
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// RenameUser changes the user name of a user and returns the renamed user.  The slug of the user may change too.
+func (client adminClient) RenameUser(userName, newName string) (User, error) {
+	body := map[string]string{"name": userName, "newName": newName}
+	data, err := client.sendAdmin("RenameUser", "POST", fmt.Sprintf("%s/rest/api/1.0/admin/users/rename", client.baseURL.String()), body)
+	if err != nil {
+		return User{}, err
+	}
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// SetUserPassword replaces the password of a user.
+func (client adminClient) SetUserPassword(userName, password string) error {
+	body := map[string]string{"name": userName, "password": password, "passwordConfirm": password}
+	_, err := client.sendAdmin("SetUserPassword", "PUT", fmt.Sprintf("%s/rest/api/1.0/admin/users/credentials", client.baseURL.String()), body)
+	return err
+}
+
+// AddUserToGroups adds a user to each of the given groups.
+func (client adminClient) AddUserToGroups(userName string, groups []string) error {
+	body := map[string]interface{}{"user": userName, "groups": groups}
+	_, err := client.sendAdmin("AddUserToGroups", "POST", fmt.Sprintf("%s/rest/api/1.0/admin/users/add-groups", client.baseURL.String()), body)
+	return err
+}
+
+// RemoveUserFromGroup removes a user from a group.
+func (client adminClient) RemoveUserFromGroup(userName, group string) error {
+	body := map[string]string{"context": userName, "itemName": group}
+	_, err := client.sendAdmin("RemoveUserFromGroup", "POST", fmt.Sprintf("%s/rest/api/1.0/admin/users/remove-group", client.baseURL.String()), body)
+	return err
+}
+
+// GetUserGroups returns the names of the groups the user is a member of.  Use GetGroupMembers for the reverse.
+func (client adminClient) GetUserGroups(userName string) ([]string, error) {
+	start := 0
+	groups := make([]string, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := url.Values{}
+			params.Set("context", userName)
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/admin/users/more-members?%s", client.baseURL.String(), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetUserGroups %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Does the user exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r adminGroups
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		for _, group := range r.Groups {
+			groups = append(groups, group.Name)
+		}
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return groups, nil
+}
+
+// CreateGroup creates an empty group.
+func (client adminClient) CreateGroup(group string) error {
+	params := url.Values{}
+	params.Set("name", group)
+	_, err := client.sendAdmin("CreateGroup", "POST", fmt.Sprintf("%s/rest/api/1.0/admin/groups?%s", client.baseURL.String(), params.Encode()), nil)
+	return err
+}
+
+// DeleteGroup deletes a group.  Its members are not deleted.
+func (client adminClient) DeleteGroup(group string) error {
+	params := url.Values{}
+	params.Set("name", group)
+	_, err := client.sendAdmin("DeleteGroup", "DELETE", fmt.Sprintf("%s/rest/api/1.0/admin/groups?%s", client.baseURL.String(), params.Encode()), nil)
+	return err
+}
+
+// sendAdmin sends an admin request with an optional JSON body and returns the response body.  Admin requests are
+// not retried because most of them are not idempotent.
+func (client adminClient) sendAdmin(operation, method, adminURL string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, adminURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	Log.Printf("stash.%s %s\n", operation, redactPassword(req.URL))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-type", "application/json")
+	}
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return nil, err
+	}
+	if responseCode != http.StatusOK && responseCode != http.StatusNoContent {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The request was rejected due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user is not an administrator."
+		case responseCode == http.StatusForbidden:
+			reason = "The operation is not permitted, e.g. deleting yourself or a group that grants your own admin access."
+		case responseCode == http.StatusNotFound:
+			reason = "The user or group was not found."
+		case responseCode == http.StatusConflict:
+			reason = "A user or group with that name already exists."
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return nil, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+	return data, nil
+}
+
+// redactPassword returns u as a string with the value of any password query parameter replaced, so that
+// CreateUser does not log the new user's password.
+func redactPassword(u *url.URL) string {
+	params := u.Query()
+	if _, ok := params["password"]; !ok {
+		return u.String()
+	}
+	params.Set("password", redacted)
+	redactedURL := *u
+	redactedURL.RawQuery = params.Encode()
+	return redactedURL.String()
+}
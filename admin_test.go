@@ -0,0 +1,250 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/admin/users" {
+			t.Fatalf("CreateUser() URL path expected to be /rest/api/1.0/admin/users but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		if params.Get("name") != "svc-ci" || params.Get("displayName") != "CI service" || params.Get("password") != "s3cret" || params.Get("addToDefaultGroup") != "false" {
+			t.Fatalf("Unexpected query %s\n", url.RawQuery)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	err := stashClient.CreateUser(NewUser{Name: "svc-ci", DisplayName: "CI service", EmailAddress: "ci@example.com", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestNewClientIsNotAdmin(t *testing.T) {
+	url, _ := url.Parse("http://stash.example.com")
+	if _, ok := NewClient("u", "p", url).(StashAdmin); ok {
+		t.Fatalf("Want NewClient not to expose admin operations\n")
+	}
+	if _, ok := NewAdminClient("u", "p", url).(Stash); !ok {
+		t.Fatalf("Want NewAdminClient to expose the ordinary operations\n")
+	}
+}
+
+func TestCreateUserDoesNotLogPassword(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "s3cret" {
+			t.Fatalf("Want the password sent but got %s\n", r.URL.RawQuery)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	var buffer bytes.Buffer
+	defer func(logger *log.Logger) { Log = logger }(Log)
+	Log = log.New(&buffer, "", 0)
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	if err := stashClient.CreateUser(NewUser{Name: "svc-ci", Password: "s3cret"}); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if !strings.Contains(buffer.String(), "stash.CreateUser") || !strings.Contains(buffer.String(), "name=svc-ci") {
+		t.Fatalf("Want the request logged but got %s\n", buffer.String())
+	}
+	if strings.Contains(buffer.String(), "s3cret") {
+		t.Fatalf("Password leaked to the log: %s\n", buffer.String())
+	}
+}
+
+func TestCreateUserNeedsPassword(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request without a password\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	if err := stashClient.CreateUser(NewUser{Name: "svc-ci", DisplayName: "CI service", EmailAddress: "ci@example.com"}); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestCreateUser409(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(409)
+		fmt.Fprint(w, `{"errors": [{"message": "A user with this name already exists."}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	err := stashClient.CreateUser(NewUser{Name: "svc-ci", Notify: true})
+	if err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+	if !IsRepositoryExists(err) {
+		t.Fatalf("Want a conflict but got %v\n", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/api/1.0/admin/users" || r.URL.Query().Get("name") != "svc-ci" {
+			t.Fatalf("Unexpected URL %s\n", r.URL)
+		}
+		fmt.Fprint(w, `{"name": "svc-ci", "slug": "svc-ci", "active": true}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	user, err := stashClient.DeleteUser("svc-ci")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if user.Slug != "svc-ci" {
+		t.Fatalf("Want svc-ci but got %+v\n", user)
+	}
+}
+
+func TestAdminJSONRequests(t *testing.T) {
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		want   map[string]interface{}
+		call   func(StashAdmin) error
+	}{
+		{"RenameUser", "POST", "/rest/api/1.0/admin/users/rename", map[string]interface{}{"name": "svc-ci", "newName": "svc-build"}, func(c StashAdmin) error {
+			_, err := c.RenameUser("svc-ci", "svc-build")
+			return err
+		}},
+		{"SetUserPassword", "PUT", "/rest/api/1.0/admin/users/credentials", map[string]interface{}{"name": "svc-ci", "password": "n3w", "passwordConfirm": "n3w"}, func(c StashAdmin) error {
+			return c.SetUserPassword("svc-ci", "n3w")
+		}},
+		{"AddUserToGroups", "POST", "/rest/api/1.0/admin/users/add-groups", map[string]interface{}{"user": "svc-ci", "groups": []interface{}{"ci", "readers"}}, func(c StashAdmin) error {
+			return c.AddUserToGroups("svc-ci", []string{"ci", "readers"})
+		}},
+		{"RemoveUserFromGroup", "POST", "/rest/api/1.0/admin/users/remove-group", map[string]interface{}{"context": "svc-ci", "itemName": "readers"}, func(c StashAdmin) error {
+			return c.RemoveUserFromGroup("svc-ci", "readers")
+		}},
+	}
+
+	for _, test := range tests {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != test.method {
+				t.Fatalf("%s: wanted %s but found %s\n", test.name, test.method, r.Method)
+			}
+			if r.URL.Path != test.path {
+				t.Fatalf("%s: URL path expected to be %s but found %s\n", test.name, test.path, r.URL.Path)
+			}
+			if r.Header.Get("Content-type") != "application/json" {
+				t.Fatalf("%s: want Content-type application/json but found %s\n", test.name, r.Header.Get("Content-type"))
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			var body map[string]interface{}
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("%s: unexpected error: %v\n", test.name, err)
+			}
+			if fmt.Sprint(body) != fmt.Sprint(test.want) {
+				t.Fatalf("%s: want body %v but got %v\n", test.name, test.want, body)
+			}
+			if test.name == "RenameUser" {
+				fmt.Fprint(w, `{"name": "svc-build", "slug": "svc-build"}`)
+				return
+			}
+			w.WriteHeader(204)
+		}))
+
+		url, _ := url.Parse(testServer.URL)
+		if err := test.call(NewAdminClient("u", "p", url)); err != nil {
+			t.Fatalf("%s: not expecting error: %v\n", test.name, err)
+		}
+		testServer.Close()
+	}
+}
+
+func TestGetUserGroups(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/admin/users/more-members" {
+			t.Fatalf("GetUserGroups() URL path expected to be /rest/api/1.0/admin/users/more-members but found %s\n", url.Path)
+		}
+		if url.Query().Get("context") != "svc-ci" {
+			t.Fatalf("Want context svc-ci but got %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"name": "ci", "deletable": true}, {"name": "readers", "deletable": true}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	groups, err := stashClient.GetUserGroups("svc-ci")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(groups) != 2 || groups[0] != "ci" || groups[1] != "readers" {
+		t.Fatalf("Want ci and readers but got %v\n", groups)
+	}
+}
+
+func TestCreateAndDeleteGroup(t *testing.T) {
+	methods := make([]string, 0)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/1.0/admin/groups" || r.URL.Query().Get("name") != "ci" {
+			t.Fatalf("Unexpected URL %s\n", r.URL)
+		}
+		methods = append(methods, r.Method)
+		fmt.Fprint(w, `{"name": "ci", "deletable": true}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	if err := stashClient.CreateGroup("ci"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if err := stashClient.DeleteGroup("ci"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(methods) != 2 || methods[0] != "POST" || methods[1] != "DELETE" {
+		t.Fatalf("Want POST then DELETE but got %v\n", methods)
+	}
+}
+
+func TestDeleteGroup401(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewAdminClient("u", "p", url)
+	if err := stashClient.DeleteGroup("ci"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
@@ -0,0 +1,299 @@
+package stash
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveZip   ArchiveFormat = "zip"
+	ArchiveTar   ArchiveFormat = "tar"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveTgz   ArchiveFormat = "tgz"
+)
+
+// GetArchive streams an archive of the repository at the given branch, tag or commit to w.  paths limits the
+// archive to the given files and directories and prefix, if not empty, is prepended to every entry, e.g.
+// "slug-1.0/".  An empty format produces a zip archive.
+func (client Client) GetArchive(projectKey, repositorySlug, at string, format ArchiveFormat, paths []string, prefix string, w io.Writer) error {
+	params := atValues(at)
+	if format != "" {
+		params.Set("format", string(format))
+	}
+	for _, p := range paths {
+		params.Add("path", p)
+	}
+	if prefix != "" {
+		params.Set("prefix", prefix)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/archive?%s", client.baseURL.String(), projectKey, repositorySlug, params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	Log.Printf("stash.GetArchive %s\n", req.URL)
+	req.SetBasicAuth(client.userName, client.password)
+
+	response, err := streamingHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var reason string = "unhandled reason"
+		switch {
+		case response.StatusCode == http.StatusBadRequest:
+			reason = "Bad request.  Is the format one of zip, tar, tar.gz or tgz?"
+		case response.StatusCode == http.StatusNotFound:
+			reason = "Not found.  Do the ref and the paths exist?"
+		case response.StatusCode == http.StatusUnauthorized:
+			reason = "Unauthorized"
+		}
+		return errorResponse{StatusCode: response.StatusCode, Reason: reason}
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// ExtractArchive extracts an archive produced by GetArchive into dir, creating dir if needed.  Entries that would
+// land outside dir, or be written through a symbolic link, and symbolic links that could resolve outside dir are
+// refused and extraction stops with an error.
+func ExtractArchive(r io.Reader, format ArchiveFormat, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	switch format {
+	case ArchiveZip, "":
+		return extractZip(r, dir)
+	case ArchiveTar:
+		return extractTar(r, dir)
+	case ArchiveTarGz, ArchiveTgz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dir)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func extractTar(r io.Reader, dir string) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := makeArchiveDirs(dir, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(dir, target, os.FileMode(header.Mode), archive); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := writeArchiveSymlink(dir, target, header.Linkname); err != nil {
+				return err
+			}
+		default:
+			// git archives hold only directories, files and symbolic links; pax headers are consumed by
+			// the tar reader.
+		}
+	}
+}
+
+func extractZip(r io.Reader, dir string) error {
+	// zip needs random access, so spool the archive to a temporary file first.
+	spool, err := ioutil.TempFile("", "stash-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range archive.File {
+		target, err := archiveEntryPath(dir, entry.Name)
+		if err != nil {
+			return err
+		}
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			if err := makeArchiveDirs(dir, target); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			content, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			link, err := ioutil.ReadAll(content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+			if err := writeArchiveSymlink(dir, target, string(link)); err != nil {
+				return err
+			}
+		default:
+			content, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			err = writeArchiveFile(dir, target, mode, content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// archiveEntryPath returns where an archive entry belongs below dir, refusing absolute names and names that
+// climb out of dir.
+func archiveEntryPath(dir, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !withinDir(dir, target) {
+		return "", fmt.Errorf("archive entry %q is outside the target directory", name)
+	}
+	return target, nil
+}
+
+// makeArchiveDirs creates target and its missing parents below dir.  It refuses to go through a symbolic link or
+// anything else that is not a directory, so that later entries cannot be redirected out of dir.
+func makeArchiveDirs(dir, target string) error {
+	relative, err := filepath.Rel(filepath.Clean(dir), target)
+	if err != nil {
+		return err
+	}
+	current := filepath.Clean(dir)
+	if relative == "." {
+		return nil
+	}
+	for _, component := range strings.Split(relative, string(filepath.Separator)) {
+		current = filepath.Join(current, component)
+		info, err := os.Lstat(current)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("archive entry %q is below a symbolic link", target)
+		case !info.IsDir():
+			return fmt.Errorf("archive entry %q is below a file", target)
+		}
+	}
+	return nil
+}
+
+// removeArchiveEntry removes what an earlier entry left at target, so that the new entry replaces it rather than
+// being written through it.
+func removeArchiveEntry(target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("archive entry %q would replace a directory", target)
+	}
+	return os.Remove(target)
+}
+
+func writeArchiveFile(dir, target string, mode os.FileMode, content io.Reader) error {
+	if err := makeArchiveDirs(dir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := removeArchiveEntry(target); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeArchiveSymlink creates a symbolic link to link at target.  Only relative links whose ".." components all
+// come first are accepted, e.g. "../lib/x.so" but not "a/../..": the leading ".." components climb through real
+// directories, which must stay within dir, and every other component is a directory, file or link below dir,
+// itself held to the same rule, so the link cannot resolve outside dir whatever entries follow it.
+func writeArchiveSymlink(dir, target, link string) error {
+	if link == "" || filepath.IsAbs(link) || strings.HasPrefix(link, "/") {
+		return fmt.Errorf("archive symbolic link %q is not a relative path", link)
+	}
+	climbing := true
+	for _, component := range strings.Split(link, "/") {
+		if component == ".." {
+			if !climbing {
+				return fmt.Errorf("archive symbolic link %q climbs after descending", link)
+			}
+			continue
+		}
+		climbing = false
+	}
+	link = path.Clean(link)
+	if !withinDir(dir, filepath.Join(filepath.Dir(target), filepath.FromSlash(link))) {
+		return fmt.Errorf("archive symbolic link %q points outside the target directory", link)
+	}
+
+	if err := makeArchiveDirs(dir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := removeArchiveEntry(target); err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(link), target)
+}
+
+func withinDir(dir, target string) bool {
+	relative, err := filepath.Rel(filepath.Clean(dir), target)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,192 @@
+package stash
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name     string
+	content  string
+	linkname string
+}
+
+func tarGz(t *testing.T, entries []archiveEntry) []byte {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.linkname != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Linkname: entry.linkname, Typeflag: tar.TypeSymlink}
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if _, err := archive.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+	}
+	archive.Close()
+	gz.Close()
+	return buffer.Bytes()
+}
+
+func zipped(t *testing.T, entries []archiveEntry) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(0644)
+		content := entry.content
+		if entry.linkname != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			content = entry.linkname
+		}
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		w.Write([]byte(content))
+	}
+	archive.Close()
+	return buffer.Bytes()
+}
+
+func TestGetArchive(t *testing.T) {
+	archive := tarGz(t, []archiveEntry{{name: "slug-1.0/pom.xml", content: "<project/>"}})
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/archive" {
+			t.Fatalf("GetArchive() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/archive but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		if params.Get("at") != "refs/tags/v1.0" || params.Get("format") != "tar.gz" || params.Get("prefix") != "slug-1.0/" {
+			t.Fatalf("Want at, format and prefix but found %s\n", url.RawQuery)
+		}
+		if strings.Join(params["path"], ",") != "pom.xml,src" {
+			t.Fatalf("Want paths pom.xml,src but found %v\n", params["path"])
+		}
+		w.Write(archive)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	var buffer bytes.Buffer
+	if err := stashClient.GetArchive("PROJ", "slug", TagRef("v1.0"), ArchiveTarGz, []string{"pom.xml", "src"}, "slug-1.0/", &buffer); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), archive) {
+		t.Fatalf("Want the archive the server sent\n")
+	}
+}
+
+func TestGetArchive404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	var buffer bytes.Buffer
+	if err := stashClient.GetArchive("PROJ", "slug", "nope", ArchiveZip, nil, "", &buffer); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+	if buffer.Len() != 0 {
+		t.Fatalf("Want nothing written but got %d bytes\n", buffer.Len())
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "pom.xml", content: "<project/>"},
+		{name: "src/main/App.java", content: "class App {}"},
+		{name: "src/main/pom.xml", linkname: "../../pom.xml"},
+	}
+	for format, archive := range map[ArchiveFormat][]byte{ArchiveTgz: tarGz(t, entries), ArchiveZip: zipped(t, entries)} {
+		dir, err := ioutil.TempDir("", "stash-extract-")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := ExtractArchive(bytes.NewReader(archive), format, dir); err != nil {
+			t.Fatalf("%s: not expecting error: %v\n", format, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "src", "main", "App.java"))
+		if err != nil {
+			t.Fatalf("%s: not expecting error: %v\n", format, err)
+		}
+		if string(data) != "class App {}" {
+			t.Fatalf("%s: want class App {} but got %s\n", format, string(data))
+		}
+		data, err = ioutil.ReadFile(filepath.Join(dir, "src", "main", "pom.xml"))
+		if err != nil || string(data) != "<project/>" {
+			t.Fatalf("%s: want the linked pom.xml but got %s %v\n", format, string(data), err)
+		}
+	}
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	var tests = []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"dot dot", []archiveEntry{{name: "../escape.txt", content: "x"}}},
+		{"absolute", []archiveEntry{{name: "/tmp/escape.txt", content: "x"}}},
+		{"symlink", []archiveEntry{{name: "link", linkname: "../../etc"}}},
+		{"abs symlink", []archiveEntry{{name: "link", linkname: "/etc"}}},
+		{"nested climb", []archiveEntry{{name: "a/../../escape.txt", content: "x"}}},
+		// a is the target directory itself, so a/b would be its parent.
+		{"chained symlinks", []archiveEntry{
+			{name: "a", linkname: "."},
+			{name: "a/b", linkname: ".."},
+			{name: "b/escape.txt", content: "x"},
+		}},
+		// each link is inside on its own, but c/.. through a is the parent of the target directory.
+		{"climb through symlink", []archiveEntry{
+			{name: "a", linkname: "."},
+			{name: "c", linkname: "a/.."},
+			{name: "c/escape.txt", content: "x"},
+		}},
+		{"write through symlink", []archiveEntry{
+			{name: "sub/up", linkname: ".."},
+			{name: "sub/up/escape.txt", content: "x"},
+		}},
+	}
+	for _, test := range tests {
+		for format, archive := range map[ArchiveFormat][]byte{ArchiveTarGz: tarGz(t, test.entries), ArchiveZip: zipped(t, test.entries)} {
+			dir, err := ioutil.TempDir("", "stash-extract-")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v\n", err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := ExtractArchive(bytes.NewReader(archive), format, filepath.Join(dir, "out")); err == nil {
+				t.Fatalf("%s %s: expecting error but did not get one\n", format, test.name)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "escape.txt")); err == nil {
+				t.Fatalf("%s %s: want nothing written outside the target directory\n", format, test.name)
+			}
+		}
+	}
+}
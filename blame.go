@@ -0,0 +1,78 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// BlameRange attributes SpannedLines lines of a file, starting at LineNumber, to the commit that last changed them.
+type BlameRange struct {
+	Author            Person `json:"author"`
+	AuthorTimestamp   int64  `json:"authorTimestamp"`
+	CommitHash        string `json:"commitHash"`
+	DisplayCommitHash string `json:"displayCommitHash"`
+	FileName          string `json:"fileName"`
+	LineNumber        int    `json:"lineNumber"`
+	SpannedLines      int    `json:"spannedLines"`
+}
+
+// GetBlame returns the blame of the file at filePath at the given branch, tag or commit, as ranges of lines
+// ordered by line number.  FileName is the name the lines had in the commit that last changed them, which
+// differs from filePath if the file has since been renamed.
+func (client Client) GetBlame(projectKey, repositorySlug, filePath, at string) ([]BlameRange, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var blame []BlameRange
+	work := func() error {
+		params := atValues(at)
+		params.Set("blame", "true")
+		params.Set("noContent", "true")
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/browse%s?%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath), params.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetBlame %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Do the file and the ref exist?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &blame)
+	}
+
+	return blame, retry.Try(work)
+}
+
+// GetPathHistory returns the commits that touched the file or directory at filePath, newest first, as seen from
+// the given branch, tag or commit.
+func (client Client) GetPathHistory(projectKey, repositorySlug, filePath, at string) ([]Commit, error) {
+	return client.GetCommits(projectKey, repositorySlug, CommitListOptions{Until: at, Path: filePath})
+}
+
+// AuthorTime returns the author timestamp of the commit that last changed the lines.
+func (blame BlameRange) AuthorTime() time.Time {
+	return millisToTime(blame.AuthorTimestamp)
+}
+
+// LastLine returns the number of the last line in the range.
+func (blame BlameRange) LastLine() int {
+	return blame.LineNumber + blame.SpannedLines - 1
+}
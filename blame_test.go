@@ -0,0 +1,115 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const blameResponse string = `
+[
+	{
+		"author": {
+			"name": "charlie",
+			"emailAddress": "charlie@example.com"
+		},
+		"authorTimestamp": 1420070400000,
+		"commitHash": "def0123abcdef4567abcdef8987abcdef6543abc",
+		"displayCommitHash": "def0123abcd",
+		"fileName": "src/Main.java",
+		"lineNumber": 1,
+		"spannedLines": 4
+	},
+	{
+		"author": {
+			"name": "dana",
+			"emailAddress": "dana@example.com"
+		},
+		"authorTimestamp": 1420156800000,
+		"commitHash": "abcdef0123abcdef4567abcdef8987abcdef6543",
+		"displayCommitHash": "abcdef0",
+		"fileName": "src/App.java",
+		"lineNumber": 5,
+		"spannedLines": 2
+	}
+]
+`
+
+func TestGetBlame(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/browse/src/App.java" {
+			t.Fatalf("GetBlame() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/browse/src/App.java but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		if params.Get("blame") != "true" || params.Get("noContent") != "true" || params.Get("at") != "master" {
+			t.Fatalf("Want blame, noContent and at=master but found %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, blameResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	blame, err := stashClient.GetBlame("PROJ", "slug", "src/App.java", "master")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(blame) != 2 {
+		t.Fatalf("Want 2 ranges but got %d\n", len(blame))
+	}
+	if blame[0].Author.Name != "charlie" || blame[0].LastLine() != 4 {
+		t.Fatalf("Want lines 1-4 by charlie but got %+v\n", blame[0])
+	}
+	if blame[1].CommitHash != "abcdef0123abcdef4567abcdef8987abcdef6543" || blame[1].LastLine() != 6 {
+		t.Fatalf("Want lines 5-6 from abcdef0 but got %+v\n", blame[1])
+	}
+	if blame[1].AuthorTime().Unix() != 1420156800 {
+		t.Fatalf("Want 1420156800 but got %d\n", blame[1].AuthorTime().Unix())
+	}
+}
+
+func TestGetBlame404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetBlame("PROJ", "slug", "missing", "master"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestGetPathHistory(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/commits" {
+			t.Fatalf("GetPathHistory() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/commits but found %s\n", url.Path)
+		}
+		if url.Query().Get("path") != "src/App.java" || url.Query().Get("until") != "release/2.0" {
+			t.Fatalf("Want path=src/App.java and until=release/2.0 but found %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, commitsPage2)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	commits, err := stashClient.GetPathHistory("PROJ", "slug", "src/App.java", "release/2.0")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Want 1 commit but got %d\n", len(commits))
+	}
+}
@@ -0,0 +1,189 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	BuildState string
+
+	BuildStatuses struct {
+		Page
+		BuildStatuses []BuildStatus `json:"values"`
+	}
+
+	// BuildStatus is the result of one build of a commit.  Key identifies the build plan; posting a status
+	// with the same key replaces the previous one.
+	BuildStatus struct {
+		State       BuildState `json:"state"`
+		Key         string     `json:"key"`
+		Name        string     `json:"name,omitempty"`
+		URL         string     `json:"url"`
+		Description string     `json:"description,omitempty"`
+		DateAdded   int64      `json:"dateAdded,omitempty"`
+	}
+
+	BuildStats struct {
+		Successful int `json:"successful"`
+		InProgress int `json:"inProgress"`
+		Failed     int `json:"failed"`
+	}
+)
+
+const (
+	BuildSuccessful BuildState = "SUCCESSFUL"
+	BuildInProgress BuildState = "INPROGRESS"
+	BuildFailed     BuildState = "FAILED"
+)
+
+// SetBuildStatus records the state of the build identified by key against the given commit.
+func (client Client) SetBuildStatus(commitID, key string, state BuildState, name, url, description string) error {
+	data, err := json.Marshal(BuildStatus{State: state, Key: key, Name: name, URL: url, Description: description})
+	if err != nil {
+		return err
+	}
+
+	work := func() error {
+		req, err := http.NewRequest("POST", fmt.Sprintf("%s/rest/build-status/1.0/commits/%s", client.baseURL.String(), commitID), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.SetBuildStatus %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-type", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		switch responseCode {
+		case http.StatusNoContent:
+			return nil
+		case http.StatusBadRequest:
+			return errorResponse{StatusCode: responseCode, Reason: "Bad request.  Are the state, key and url set?"}
+		case http.StatusUnauthorized:
+			return errorResponse{StatusCode: responseCode, Reason: "Unauthorized"}
+		default:
+			return errorResponse{StatusCode: responseCode, Reason: "(unhandled reason)"}
+		}
+	}
+	return retry.New(3*time.Second, 3, retry.DefaultBackoffFunc).Try(work)
+}
+
+// GetBuildStatuses returns the build statuses recorded against the given commit.
+func (client Client) GetBuildStatuses(commitID string) ([]BuildStatus, error) {
+	start := 0
+	statuses := make([]BuildStatus, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/build-status/1.0/commits/%s?start=%d&limit=%d", client.baseURL.String(), commitID, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetBuildStatuses %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r BuildStatuses
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, r.BuildStatuses...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return statuses, nil
+}
+
+// GetBuildStats returns the number of successful, in progress and failed builds of each of the given commits,
+// indexed by commit id.  Commits without builds are reported with zero counts.
+func (client Client) GetBuildStats(commitIDs ...string) (map[string]BuildStats, error) {
+	if commitIDs == nil {
+		commitIDs = []string{}
+	}
+	body, err := json.Marshal(commitIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var stats map[string]BuildStats
+	work := func() error {
+		req, err := http.NewRequest("POST", fmt.Sprintf("%s/rest/build-status/1.0/commits/stats", client.baseURL.String()), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetBuildStats %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-type", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusBadRequest:
+				reason = "Bad request"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &stats)
+	}
+	if err := retry.Try(work); err != nil {
+		return nil, err
+	}
+
+	if stats == nil {
+		stats = make(map[string]BuildStats)
+	}
+	for _, id := range commitIDs {
+		if _, ok := stats[id]; !ok {
+			stats[id] = BuildStats{}
+		}
+	}
+	return stats, nil
+}
+
+// DateAddedTime returns when the status was recorded.
+func (status BuildStatus) DateAddedTime() time.Time {
+	return millisToTime(status.DateAdded)
+}
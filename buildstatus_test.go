@@ -0,0 +1,155 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const buildStatusesResponse string = `
+{
+	"size": 2,
+	"limit": 25,
+	"isLastPage": true,
+	"start": 0,
+	"values": [
+		{
+			"state": "SUCCESSFUL",
+			"key": "REPO-MASTER",
+			"name": "REPO-MASTER-42",
+			"url": "https://ci.example.com/browse/REPO-MASTER-42",
+			"description": "Changes by Charlie",
+			"dateAdded": 1420070400000
+		},
+		{
+			"state": "FAILED",
+			"key": "REPO-INTEGRATION",
+			"url": "https://ci.example.com/browse/REPO-INTEGRATION-7",
+			"dateAdded": 1420070500000
+		}
+	]
+}
+`
+
+func TestSetBuildStatus(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/build-status/1.0/commits/def0123abcd" {
+			t.Fatalf("SetBuildStatus() URL path expected to be /rest/build-status/1.0/commits/def0123abcd but found %s\n", url.Path)
+		}
+		if r.Header.Get("Content-type") != "application/json" {
+			t.Fatalf("Want Content-type application/json but found %s\n", r.Header.Get("Content-type"))
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var status BuildStatus
+		if err := json.Unmarshal(data, &status); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if status.State != BuildInProgress || status.Key != "REPO-MASTER" || status.URL != "https://ci.example.com/browse/REPO-MASTER-43" {
+			t.Fatalf("Want an in progress REPO-MASTER status but got %+v\n", status)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	err := stashClient.SetBuildStatus("def0123abcd", "REPO-MASTER", BuildInProgress, "REPO-MASTER-43", "https://ci.example.com/browse/REPO-MASTER-43", "")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestSetBuildStatus400(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.SetBuildStatus("def0123abcd", "", BuildFailed, "", "", ""); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestGetBuildStatuses(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/build-status/1.0/commits/def0123abcd" {
+			t.Fatalf("GetBuildStatuses() URL path expected to be /rest/build-status/1.0/commits/def0123abcd but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, buildStatusesResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	statuses, err := stashClient.GetBuildStatuses("def0123abcd")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Want 2 statuses but got %d\n", len(statuses))
+	}
+	if statuses[1].State != BuildFailed || statuses[1].Key != "REPO-INTEGRATION" {
+		t.Fatalf("Want a failed REPO-INTEGRATION build but got %+v\n", statuses[1])
+	}
+	if statuses[0].DateAddedTime().Unix() != 1420070400 {
+		t.Fatalf("Want 1420070400 but got %d\n", statuses[0].DateAddedTime().Unix())
+	}
+}
+
+func TestGetBuildStats(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/build-status/1.0/commits/stats" {
+			t.Fatalf("GetBuildStats() URL path expected to be /rest/build-status/1.0/commits/stats but found %s\n", url.Path)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var ids []string
+		if err := json.Unmarshal(data, &ids); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if len(ids) != 2 {
+			t.Fatalf("Want 2 commit ids but got %v\n", ids)
+		}
+		fmt.Fprint(w, `{"def0123abcd": {"successful": 2, "inProgress": 1, "failed": 0}}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	stats, err := stashClient.GetBuildStats("def0123abcd", "abcdef0")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if stats["def0123abcd"].Successful != 2 || stats["def0123abcd"].InProgress != 1 {
+		t.Fatalf("Want 2 successful and 1 in progress but got %+v\n", stats["def0123abcd"])
+	}
+	if _, ok := stats["abcdef0"]; !ok {
+		t.Fatalf("Want zero stats for abcdef0 but found none\n")
+	}
+}
@@ -0,0 +1,320 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	ChangeType string
+	NodeType   string
+
+	Changes struct {
+		Page
+		Changes []Change `json:"values"`
+	}
+
+	// Change is a file added, modified, deleted, moved or copied between two commits.  SrcPath is set for
+	// moves and copies.
+	Change struct {
+		ContentID        string     `json:"contentId"`
+		FromContentID    string     `json:"fromContentId"`
+		Path             Path       `json:"path"`
+		SrcPath          *Path      `json:"srcPath"`
+		Type             ChangeType `json:"type"`
+		NodeType         NodeType   `json:"nodeType"`
+		Executable       bool       `json:"executable"`
+		SrcExecutable    bool       `json:"srcExecutable"`
+		PercentUnchanged int        `json:"percentUnchanged"`
+	}
+
+	Path struct {
+		Components []string `json:"components"`
+		Parent     string   `json:"parent"`
+		Name       string   `json:"name"`
+		Extension  string   `json:"extension"`
+		ToString   string   `json:"toString"`
+	}
+
+	// Diffs is the diff between two commits.  Truncated is set when the server stopped short of the full diff.
+	Diffs struct {
+		FromHash     string `json:"fromHash"`
+		ToHash       string `json:"toHash"`
+		ContextLines int    `json:"contextLines"`
+		Whitespace   string `json:"whitespace"`
+		Diffs        []Diff `json:"diffs"`
+		Truncated    bool   `json:"truncated"`
+	}
+
+	// Diff is the diff of one file.  Source is nil for added files and Destination is nil for deleted files.
+	Diff struct {
+		Source      *Path      `json:"source"`
+		Destination *Path      `json:"destination"`
+		Hunks       []DiffHunk `json:"hunks"`
+		Binary      bool       `json:"binary"`
+		Truncated   bool       `json:"truncated"`
+	}
+
+	DiffHunk struct {
+		SourceLine      int           `json:"sourceLine"`
+		SourceSpan      int           `json:"sourceSpan"`
+		DestinationLine int           `json:"destinationLine"`
+		DestinationSpan int           `json:"destinationSpan"`
+		Segments        []DiffSegment `json:"segments"`
+		Truncated       bool          `json:"truncated"`
+	}
+
+	DiffSegment struct {
+		Type      DiffSegmentType `json:"type"`
+		Lines     []DiffLine      `json:"lines"`
+		Truncated bool            `json:"truncated"`
+	}
+
+	DiffSegmentType string
+
+	DiffLine struct {
+		Source      int    `json:"source"`
+		Destination int    `json:"destination"`
+		Line        string `json:"line"`
+		Truncated   bool   `json:"truncated"`
+	}
+)
+
+const (
+	ChangeAdd    ChangeType = "ADD"
+	ChangeModify ChangeType = "MODIFY"
+	ChangeDelete ChangeType = "DELETE"
+	ChangeMove   ChangeType = "MOVE"
+	ChangeCopy   ChangeType = "COPY"
+)
+
+const (
+	NodeFile      NodeType = "FILE"
+	NodeDirectory NodeType = "DIRECTORY"
+	NodeSubmodule NodeType = "SUBMODULE"
+)
+
+const (
+	SegmentAdded   DiffSegmentType = "ADDED"
+	SegmentRemoved DiffSegmentType = "REMOVED"
+	SegmentContext DiffSegmentType = "CONTEXT"
+)
+
+// GetChanges returns the files changed between the from and to branches, tags or commits.
+func (client Client) GetChanges(projectKey, repositorySlug, from, to string) ([]Change, error) {
+	params := url.Values{}
+	params.Set("since", from)
+	params.Set("until", to)
+	return client.getChanges("GetChanges", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/changes", client.baseURL.String(), projectKey, repositorySlug), params)
+}
+
+// CompareChanges returns the files changed on from that are not on to, as a pull request from from to to
+// would show them.
+func (client Client) CompareChanges(projectKey, repositorySlug, from, to string) ([]Change, error) {
+	params := url.Values{}
+	params.Set("from", from)
+	params.Set("to", to)
+	return client.getChanges("CompareChanges", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/compare/changes", client.baseURL.String(), projectKey, repositorySlug), params)
+}
+
+func (client Client) getChanges(operation, changesURL string, params url.Values) ([]Change, error) {
+	start := 0
+	changes := make([]Change, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s?%s", changesURL, params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.%s %s\n", operation, req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusBadRequest:
+					reason = "Bad request.  Do both refs exist?"
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Changes
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		changes = append(changes, r.Changes...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return changes, nil
+}
+
+// CompareCommits returns the commits on from that are not on to, newest first.
+func (client Client) CompareCommits(projectKey, repositorySlug, from, to string) ([]Commit, error) {
+	start := 0
+	commits := make([]Commit, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := url.Values{}
+			params.Set("from", from)
+			params.Set("to", to)
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/compare/commits?%s", client.baseURL.String(), projectKey, repositorySlug, params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.CompareCommits %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusBadRequest:
+					reason = "Bad request.  Do both refs exist?"
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Commits
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		commits = append(commits, r.Commits...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return commits, nil
+}
+
+// GetDiff returns the diff between the from and to branches, tags or commits, limited to filePath if it is
+// not empty.
+func (client Client) GetDiff(projectKey, repositorySlug, from, to, filePath string) (Diffs, error) {
+	params := url.Values{}
+	params.Set("since", from)
+	params.Set("until", to)
+	return client.getDiff("GetDiff", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/diff%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath)), params)
+}
+
+// CompareDiff returns the diff of the changes on from that are not on to, limited to filePath if it is not empty.
+func (client Client) CompareDiff(projectKey, repositorySlug, from, to, filePath string) (Diffs, error) {
+	params := url.Values{}
+	params.Set("from", from)
+	params.Set("to", to)
+	return client.getDiff("CompareDiff", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/compare/diff%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath)), params)
+}
+
+func (client Client) getDiff(operation, diffURL string, params url.Values) (Diffs, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var diffs Diffs
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s?%s", diffURL, params.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusBadRequest:
+				reason = "Bad request.  Do both refs exist?"
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &diffs)
+	}
+
+	return diffs, retry.Try(work)
+}
+
+// String returns the path as a slash separated string.
+func (path Path) String() string {
+	return path.ToString
+}
+
+// IsRename reports whether the diff moves a file from one path to another.
+func (diff Diff) IsRename() bool {
+	return diff.Source != nil && diff.Destination != nil && diff.Source.ToString != diff.Destination.ToString
+}
+
+// IsTruncated reports whether any part of the diff was cut short by the server.
+func (diffs Diffs) IsTruncated() bool {
+	if diffs.Truncated {
+		return true
+	}
+	for _, diff := range diffs.Diffs {
+		if diff.Truncated {
+			return true
+		}
+		for _, hunk := range diff.Hunks {
+			if hunk.Truncated {
+				return true
+			}
+			for _, segment := range hunk.Segments {
+				if segment.Truncated {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const changesResponse string = `
+{
+	"isLastPage": true,
+	"values": [
+		{
+			"contentId": "abcdef0123abcdef4567abcdef8987abcdef6543",
+			"fromContentId": "bcdef0123abcdef4567abcdef8987abcdef6543a",
+			"path": {
+				"components": ["services", "billing", "pom.xml"],
+				"parent": "services/billing",
+				"name": "pom.xml",
+				"extension": "xml",
+				"toString": "services/billing/pom.xml"
+			},
+			"executable": false,
+			"percentUnchanged": 98,
+			"type": "MODIFY",
+			"nodeType": "FILE",
+			"srcExecutable": false
+		},
+		{
+			"contentId": "cdef0123abcdef4567abcdef8987abcdef6543ab",
+			"path": {
+				"components": ["services", "payments", "README.md"],
+				"parent": "services/payments",
+				"name": "README.md",
+				"extension": "md",
+				"toString": "services/payments/README.md"
+			},
+			"srcPath": {
+				"components": ["services", "billing", "README.md"],
+				"parent": "services/billing",
+				"name": "README.md",
+				"extension": "md",
+				"toString": "services/billing/README.md"
+			},
+			"percentUnchanged": 100,
+			"type": "MOVE",
+			"nodeType": "FILE"
+		}
+	]
+}
+`
+
+const diffResponse string = `
+{
+	"fromHash": "bcdef0123abcdef4567abcdef8987abcdef6543a",
+	"toHash": "abcdef0123abcdef4567abcdef8987abcdef6543",
+	"contextLines": 10,
+	"whitespace": "SHOW",
+	"diffs": [
+		{
+			"source": { "toString": "docs/old name.md" },
+			"destination": { "toString": "docs/new name.md" },
+			"hunks": [
+				{
+					"sourceLine": 1,
+					"sourceSpan": 1,
+					"destinationLine": 1,
+					"destinationSpan": 2,
+					"segments": [
+						{
+							"type": "CONTEXT",
+							"lines": [ { "source": 1, "destination": 1, "line": "# Title", "truncated": false } ],
+							"truncated": false
+						},
+						{
+							"type": "ADDED",
+							"lines": [ { "source": 2, "destination": 2, "line": "more", "truncated": false } ],
+							"truncated": true
+						}
+					],
+					"truncated": false
+				}
+			],
+			"truncated": false
+		},
+		{
+			"source": null,
+			"destination": { "toString": "docs/logo.png" },
+			"binary": true
+		}
+	],
+	"truncated": false
+}
+`
+
+func TestGetChanges(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/changes" {
+			t.Fatalf("GetChanges() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/changes but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		if url.Query().Get("since") != "v1.0" || url.Query().Get("until") != "v1.1" {
+			t.Fatalf("Want since=v1.0 and until=v1.1 but found %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, changesResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	changes, err := stashClient.GetChanges("PROJ", "slug", "v1.0", "v1.1")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Want 2 changes but got %d\n", len(changes))
+	}
+	if changes[0].Path.Parent != "services/billing" || changes[0].Type != ChangeModify {
+		t.Fatalf("Want a modification in services/billing but got %+v\n", changes[0])
+	}
+	if changes[1].Type != ChangeMove || changes[1].SrcPath.String() != "services/billing/README.md" {
+		t.Fatalf("Want a move from services/billing/README.md but got %+v\n", changes[1])
+	}
+}
+
+func TestCompareChanges(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/compare/changes" {
+			t.Fatalf("CompareChanges() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/compare/changes but found %s\n", url.Path)
+		}
+		if url.Query().Get("from") != "feature/x" || url.Query().Get("to") != "master" {
+			t.Fatalf("Want from=feature/x and to=master but found %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, changesResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.CompareChanges("PROJ", "slug", "feature/x", "master"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestCompareCommits(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/compare/commits" {
+			t.Fatalf("CompareCommits() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/compare/commits but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, commitsPage2)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	commits, err := stashClient.CompareCommits("PROJ", "slug", "feature/x", "master")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Want 1 commit but got %d\n", len(commits))
+	}
+}
+
+func TestGetDiff(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.EscapedPath() != "/rest/api/1.0/projects/PROJ/repos/slug/diff/docs/new%20name.md" {
+			t.Fatalf("GetDiff() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/diff/docs/new%%20name.md but found %s\n", url.EscapedPath())
+		}
+		fmt.Fprint(w, diffResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	diffs, err := stashClient.GetDiff("PROJ", "slug", "v1.0", "v1.1", "docs/new name.md")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(diffs.Diffs) != 2 {
+		t.Fatalf("Want 2 diffs but got %d\n", len(diffs.Diffs))
+	}
+	if !diffs.Diffs[0].IsRename() {
+		t.Fatalf("Want a rename but got %+v\n", diffs.Diffs[0])
+	}
+	if diffs.Diffs[0].Hunks[0].Segments[1].Type != SegmentAdded {
+		t.Fatalf("Want an ADDED segment but got %s\n", diffs.Diffs[0].Hunks[0].Segments[1].Type)
+	}
+	if !diffs.Diffs[1].Binary || diffs.Diffs[1].IsRename() {
+		t.Fatalf("Want an added binary file but got %+v\n", diffs.Diffs[1])
+	}
+	if !diffs.IsTruncated() {
+		t.Fatalf("Want a truncated diff\n")
+	}
+}
+
+func TestCompareDiff(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/compare/diff" {
+			t.Fatalf("CompareDiff() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/compare/diff but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, diffResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.CompareDiff("PROJ", "slug", "feature/x", "master", ""); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestGetDiff404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetDiff("PROJ", "slug", "v1.0", "v1.1", ""); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
@@ -0,0 +1,159 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	Commits struct {
+		Page
+		Commits []Commit `json:"values"`
+	}
+
+	// CommitListOptions selects the commits returned by GetCommits.  The zero value lists every commit reachable
+	// from the default branch, newest first.
+	CommitListOptions struct {
+		// Until is the branch, tag or commit to list back from.
+		Until string
+		// Since excludes commits reachable from this branch, tag or commit, so Since..Until lists the
+		// commits between two refs.
+		Since string
+		// Path limits the result to commits that touch the given file or directory.
+		Path string
+		// Merges includes, excludes or lists only merge commits.
+		Merges MergesFilter
+		// FollowRenames follows Path across renames.  It only applies when Path names a file.
+		FollowRenames bool
+		// Limit caps the number of commits returned.  Zero means no limit.
+		Limit int
+	}
+
+	MergesFilter string
+)
+
+const (
+	MergesInclude MergesFilter = "include"
+	MergesExclude MergesFilter = "exclude"
+	MergesOnly    MergesFilter = "only"
+)
+
+// GetCommits returns the commits of the given repository selected by options, newest first, reading as many
+// pages as needed.
+func (client Client) GetCommits(projectKey, repositorySlug string, options CommitListOptions) ([]Commit, error) {
+	start := 0
+	commits := make([]Commit, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := options.values()
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits?%s", client.baseURL.String(), projectKey, repositorySlug, params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetCommits %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusBadRequest:
+					reason = "Bad request.  Do the until and since refs exist?"
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Commits
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		commits = append(commits, r.Commits...)
+		if options.Limit > 0 && len(commits) >= options.Limit {
+			return commits[:options.Limit], nil
+		}
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return commits, nil
+}
+
+// GetCommit returns the commit with the given id.
+func (client Client) GetCommit(projectKey, repositorySlug, commitID string) (Commit, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var commit Commit
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits/%s", client.baseURL.String(), projectKey, repositorySlug, commitID), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetCommit %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Does the commit exist?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &commit)
+	}
+
+	return commit, retry.Try(work)
+}
+
+func (options CommitListOptions) values() url.Values {
+	params := url.Values{}
+	if options.Until != "" {
+		params.Set("until", options.Until)
+	}
+	if options.Since != "" {
+		params.Set("since", options.Since)
+	}
+	if options.Path != "" {
+		params.Set("path", options.Path)
+	}
+	if options.Merges != "" {
+		params.Set("merges", string(options.Merges))
+	}
+	if options.FollowRenames {
+		params.Set("followRenames", "true")
+	}
+	return params
+}
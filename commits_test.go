@@ -0,0 +1,175 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const commitResponse string = `
+{
+	"id": "def0123abcdef4567abcdef8987abcdef6543abc",
+	"displayId": "def0123abcd",
+	"author": {
+		"name": "charlie",
+		"emailAddress": "charlie@example.com"
+	},
+	"authorTimestamp": 1420070400000,
+	"committer": {
+		"name": "ci",
+		"emailAddress": "ci@example.com"
+	},
+	"committerTimestamp": 1420074000000,
+	"message": "More work on feature 1",
+	"parents": [
+		{
+			"id": "abcdef0123abcdef4567abcdef8987abcdef6543",
+			"displayId": "abcdef0"
+		}
+	]
+}
+`
+
+const commitsPage1 string = `
+{
+	"isLastPage": false,
+	"nextPageStart": 1,
+	"values": [
+` + commitResponse + `
+	]
+}
+`
+
+const commitsPage2 string = `
+{
+	"isLastPage": true,
+	"values": [
+		{
+			"id": "abcdef0123abcdef4567abcdef8987abcdef6543",
+			"displayId": "abcdef0",
+			"message": "Initial commit"
+		}
+	]
+}
+`
+
+func TestGetCommits(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/commits" {
+			t.Fatalf("GetCommits() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/commits but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		for k, v := range map[string]string{"until": "release/2.0", "since": "release/1.0", "path": "src/main", "merges": "exclude", "followRenames": "true"} {
+			if params.Get(k) != v {
+				t.Fatalf("Want %s=%s but found %s\n", k, v, params.Get(k))
+			}
+		}
+		if params.Get("start") == "0" {
+			fmt.Fprint(w, commitsPage1)
+		} else {
+			fmt.Fprint(w, commitsPage2)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	options := CommitListOptions{Until: "release/2.0", Since: "release/1.0", Path: "src/main", Merges: MergesExclude, FollowRenames: true}
+	commits, err := stashClient.GetCommits("PROJ", "slug", options)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Want 2 commits but got %d\n", len(commits))
+	}
+	if commits[1].Message != "Initial commit" {
+		t.Fatalf("Want Initial commit but got %s\n", commits[1].Message)
+	}
+}
+
+func TestGetCommitsLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("start") != "0" {
+			t.Fatalf("Want only the first page to be read\n")
+		}
+		fmt.Fprint(w, commitsPage1)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	commits, err := stashClient.GetCommits("PROJ", "slug", CommitListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Want 1 commit but got %d\n", len(commits))
+	}
+}
+
+func TestGetCommits400(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetCommits("PROJ", "slug", CommitListOptions{Until: "nope"}); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestGetCommit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/commits/def0123abcd" {
+			t.Fatalf("GetCommit() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/commits/def0123abcd but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, commitResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	commit, err := stashClient.GetCommit("PROJ", "slug", "def0123abcd")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+
+	// spot checks
+	if commit.Author.EmailAddress != "charlie@example.com" {
+		t.Fatalf("Want charlie@example.com but got %s\n", commit.Author.EmailAddress)
+	}
+	if commit.Committer.Name != "ci" {
+		t.Fatalf("Want ci but got %s\n", commit.Committer.Name)
+	}
+	if commit.CommitterTime().Sub(commit.AuthorTime()).Hours() != 1 {
+		t.Fatalf("Want committer time an hour after author time but got %v and %v\n", commit.CommitterTime(), commit.AuthorTime())
+	}
+	if len(commit.Parents) != 1 || commit.Parents[0].DisplayID != "abcdef0" {
+		t.Fatalf("Want parent abcdef0 but got %+v\n", commit.Parents)
+	}
+}
+
+func TestGetCommit404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetCommit("PROJ", "slug", "def0123abcd"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
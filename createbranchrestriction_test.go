@@ -1,7 +1,9 @@
 package stash
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -84,3 +86,55 @@ func TestCreateBranchRestrilction401(t *testing.T) {
 		t.Fatalf("Expecting error but did not get one\n")
 	}
 }
+
+func TestCreateBranchPermission(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var permission BranchPermission
+		if err := json.Unmarshal(data, &permission); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if len(permission.Users) != 2 || len(permission.Groups) != 1 {
+			t.Fatalf("Want 2 users and 1 group but got %+v\n", permission)
+		}
+		fmt.Fprint(w, createBranchRestrictionsResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	permission := BranchPermission{Type: "BRANCH", Branch: "develop", Users: []string{"alice", "bob"}, Groups: []string{"developers"}}
+	if _, err := stashClient.CreateBranchPermission("PROJ", "slug", permission); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestUpdateBranchRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/1.0/projects/PROJ/repos/slug/restricted/41" {
+			t.Fatalf("UpdateBranchRestriction() URL path expected to be /rest/branch-permissions/1.0/projects/PROJ/repos/slug/restricted/41 but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, createBranchRestrictionsResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	branchRestriction, err := stashClient.UpdateBranchRestriction("PROJ", "slug", 41, BranchPermission{Type: "BRANCH", Branch: "develop", Groups: []string{"developers"}})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if branchRestriction.Id != 41 {
+		t.Fatalf("Want 41 but got %d\n", branchRestriction.Id)
+	}
+}
@@ -271,8 +271,9 @@ func TestCreatePullRequest(t *testing.T) {
 	expect_to_equal(t, "Description", "a description", pullRequest.Description)
 	expect_to_equal(t, "Open", true, pullRequest.Open)
 	expect_to_equal(t, "State", "OPEN", pullRequest.State)
-	expect_to_equal(t, "FromRef", Ref{"feature/file1"}, pullRequest.FromRef)
-	expect_to_equal(t, "ToRef", Ref{"develop"}, pullRequest.ToRef)
+	expect_to_equal(t, "FromRef", "feature/file1", pullRequest.FromRef.DisplayID)
+	expect_to_equal(t, "FromRef latest changeset", "aead30bdfe27e176316bb2e2aedd530052730092", pullRequest.FromRef.LatestChangeSet)
+	expect_to_equal(t, "ToRef", "develop", pullRequest.ToRef.DisplayID)
 
 }
 
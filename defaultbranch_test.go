@@ -0,0 +1,117 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const defaultBranchResponse string = `
+{
+	"id": "refs/heads/main",
+	"displayId": "main",
+	"latestChangeset": "8d0f23745dfe4bacef9509bb4ecd7722b9aff82",
+	"isDefault": true
+}
+`
+
+func TestGetDefaultBranch(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/branches/default" {
+			t.Fatalf("GetDefaultBranch() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/branches/default but found %s\n", url.Path)
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Fatalf("GetDefaultBranch() expected request Accept header to be application/json but found %s\n", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, defaultBranchResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	branch, err := stashClient.GetDefaultBranch("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if branch.DisplayID != "main" {
+		t.Fatalf("Want main but got %s\n", branch.DisplayID)
+	}
+	if !branch.IsDefault {
+		t.Fatalf("Want isDefault but got false\n")
+	}
+}
+
+func TestGetDefaultBranch404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetDefaultBranch("PROJ", "slug"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestSetDefaultBranch(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/branches/default" {
+			t.Fatalf("SetDefaultBranch() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/branches/default but found %s\n", url.Path)
+		}
+		if r.Header.Get("Content-type") != "application/json" {
+			t.Fatalf("Want Content-type application/json but found %s\n", r.Header.Get("Content-type"))
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if body.ID != "refs/heads/main" {
+			t.Fatalf("Want refs/heads/main but got %s\n", body.ID)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	for _, name := range []string{"main", "refs/heads/main"} {
+		if err := stashClient.SetDefaultBranch("PROJ", "slug", name); err != nil {
+			t.Fatalf("Not expecting error: %v\n", err)
+		}
+	}
+}
+
+func TestSetDefaultBranch401(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.SetDefaultBranch("PROJ", "slug", "main"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
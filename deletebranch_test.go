@@ -52,3 +52,107 @@ func TestDeleteBranch(t *testing.T) {
 		t.Fatalf("Not expecting error: %v\n", err)
 	}
 }
+
+func TestDeleteBranchDryRunWithEndPoint(t *testing.T) {
+	type deleteModel struct {
+		Ref      string `json:"name"`
+		DryRun   bool   `json:"dryRun"`
+		EndPoint string `json:"endPoint"`
+	}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		var d deleteModel
+		if err := json.Unmarshal(data, &d); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if d.Ref != "refs/heads/issue/1" {
+			t.Fatalf("Want refs/heads/issue/1 but got %s\n", d.Ref)
+		}
+		if !d.DryRun {
+			t.Fatalf("Want dryRun true but got false\n")
+		}
+		if d.EndPoint != "8d0f23745dfe" {
+			t.Fatalf("Want endPoint 8d0f23745dfe but got %s\n", d.EndPoint)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	err := stashClient.DeleteBranchWithOptions("PROJ", "slug", "issue/1", DeleteBranchOptions{DryRun: true, EndPoint: "8d0f23745dfe"})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestDeleteBranch400(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteBranch("PROJ", "slug", "issue/1"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestDeleteBranches(t *testing.T) {
+	type deleteModel struct {
+		Ref      string `json:"name"`
+		EndPoint string `json:"endPoint"`
+	}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		var d deleteModel
+		if err := json.Unmarshal(data, &d); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		switch d.Ref {
+		case "refs/heads/moved":
+			if d.EndPoint != "abc123" {
+				t.Fatalf("Want endPoint abc123 but got %s\n", d.EndPoint)
+			}
+			w.WriteHeader(400)
+		default:
+			w.WriteHeader(204)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	branches := []Branch{
+		{ID: "refs/heads/stale"},
+		{ID: "refs/heads/moved", LatestChangeSet: "abc123"},
+		{DisplayID: "done"},
+	}
+	results := stashClient.DeleteBranches("PROJ", "slug", branches, false)
+	if len(results) != 3 {
+		t.Fatalf("Want 3 results but got %d\n", len(results))
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Fatalf("Want stale and done deleted but got %v, %v\n", results[0].Err, results[2].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatalf("Want an error deleting moved but got none\n")
+	}
+	if results[1].Branch.ID != "refs/heads/moved" {
+		t.Fatalf("Want result for refs/heads/moved but got %s\n", results[1].Branch.ID)
+	}
+}
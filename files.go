@@ -0,0 +1,158 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	Files struct {
+		Page
+		Files []string `json:"values"`
+	}
+
+	Directory struct {
+		Path     Path             `json:"path"`
+		Revision string           `json:"revision"`
+		Children DirectoryEntries `json:"children"`
+	}
+
+	DirectoryEntries struct {
+		Page
+		Entries []DirectoryEntry `json:"values"`
+	}
+
+	// DirectoryEntry is a file, directory or submodule in a directory listing.  Path is relative to the
+	// directory being listed.  Size is only reported for files.
+	DirectoryEntry struct {
+		Path      Path     `json:"path"`
+		ContentID string   `json:"contentId"`
+		Type      NodeType `json:"type"`
+		Size      int64    `json:"size"`
+	}
+)
+
+// ListFiles returns the paths of all files below filePath, recursively, at the given branch, tag or commit.  An
+// empty filePath lists the whole repository and an empty at uses the default branch.  Returned paths are relative
+// to filePath.
+func (client Client) ListFiles(projectKey, repositorySlug, filePath, at string) ([]string, error) {
+	start := 0
+	files := make([]string, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := atValues(at)
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/files%s?%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.ListFiles %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Do the path and the ref exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Files
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		files = append(files, r.Files...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return files, nil
+}
+
+// Browse returns the entries of the directory at filePath at the given branch, tag or commit.  An empty filePath
+// lists the root of the repository and an empty at uses the default branch.
+func (client Client) Browse(projectKey, repositorySlug, filePath, at string) ([]DirectoryEntry, error) {
+	start := 0
+	entries := make([]DirectoryEntry, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := atValues(at)
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/browse%s?%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.Browse %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Do the path and the ref exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Directory
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		if r.Children.Entries == nil {
+			return nil, fmt.Errorf("%s is not a directory", filePath)
+		}
+		entries = append(entries, r.Children.Entries...)
+		morePages = !r.Children.IsLastPage
+		start = r.Children.NextPageStart
+	}
+	return entries, nil
+}
+
+func atValues(at string) url.Values {
+	params := url.Values{}
+	if at != "" {
+		params.Set("at", at)
+	}
+	return params
+}
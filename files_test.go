@@ -0,0 +1,142 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const browseResponse string = `
+{
+	"path": {
+		"components": ["services"],
+		"name": "services",
+		"toString": "services"
+	},
+	"revision": "master",
+	"children": {
+		"size": 3,
+		"limit": 500,
+		"isLastPage": true,
+		"start": 0,
+		"values": [
+			{
+				"path": { "components": ["billing"], "name": "billing", "toString": "billing" },
+				"type": "DIRECTORY"
+			},
+			{
+				"path": { "components": ["pom.xml"], "name": "pom.xml", "extension": "xml", "toString": "pom.xml" },
+				"contentId": "abcdef0123abcdef4567abcdef8987abcdef6543",
+				"type": "FILE",
+				"size": 1024
+			},
+			{
+				"path": { "components": ["vendor"], "name": "vendor", "toString": "vendor" },
+				"contentId": "bcdef0123abcdef4567abcdef8987abcdef6543a",
+				"type": "SUBMODULE"
+			}
+		]
+	}
+}
+`
+
+const browseFileResponse string = `
+{
+	"lines": [ { "text": "hello" } ],
+	"start": 0,
+	"size": 1,
+	"isLastPage": true
+}
+`
+
+func TestListFiles(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/files/services" {
+			t.Fatalf("ListFiles() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/files/services but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		if url.Query().Get("at") != "release/2.0" {
+			t.Fatalf("Want at=release/2.0 but found %s\n", url.Query().Get("at"))
+		}
+		if url.Query().Get("start") == "0" {
+			fmt.Fprint(w, `{"isLastPage": false, "nextPageStart": 2, "values": ["pom.xml", "billing/pom.xml"]}`)
+		} else {
+			fmt.Fprint(w, `{"isLastPage": true, "values": ["payments/build.gradle"]}`)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	files, err := stashClient.ListFiles("PROJ", "slug", "services", "release/2.0")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(files) != 3 || files[2] != "payments/build.gradle" {
+		t.Fatalf("Want 3 files ending with payments/build.gradle but got %v\n", files)
+	}
+}
+
+func TestListFiles404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.ListFiles("PROJ", "slug", "", ""); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/browse/services" {
+			t.Fatalf("Browse() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/browse/services but found %s\n", url.Path)
+		}
+		if _, ok := url.Query()["at"]; ok {
+			t.Fatalf("Want no at query param but found one\n")
+		}
+		fmt.Fprint(w, browseResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	entries, err := stashClient.Browse("PROJ", "slug", "services", "")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Want 3 entries but got %d\n", len(entries))
+	}
+	if entries[0].Type != NodeDirectory || entries[2].Type != NodeSubmodule {
+		t.Fatalf("Want a directory and a submodule but got %s and %s\n", entries[0].Type, entries[2].Type)
+	}
+	if entries[1].Path.Name != "pom.xml" || entries[1].Size != 1024 {
+		t.Fatalf("Want pom.xml of size 1024 but got %+v\n", entries[1])
+	}
+}
+
+func TestBrowseFile(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, browseFileResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.Browse("PROJ", "slug", "services/pom.xml", ""); err == nil {
+		t.Fatalf("Expecting error browsing a file but did not get one\n")
+	}
+}
@@ -0,0 +1,285 @@
+package stash
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// RepositoryFS is a read-only fs.FS over a repository at a fixed branch, tag or commit.  Directory listings
+	// come from Browse and file contents from GetRawFile.  Pin the FS to a commit hash if the tree must not change
+	// while it is being read.
+	//
+	// Directory listings are remembered for the life of the FS.  File contents are only remembered if the FS was
+	// created with a ContentCache.
+	RepositoryFS struct {
+		client         Stash
+		projectKey     string
+		repositorySlug string
+		at             string
+		cache          ContentCache
+
+		mutex       sync.Mutex
+		directories map[string][]DirectoryEntry
+	}
+
+	// ContentCache stores file contents read through a RepositoryFS.  Implementations must be safe for
+	// concurrent use.
+	ContentCache interface {
+		Get(key string) ([]byte, bool)
+		Put(key string, data []byte)
+	}
+
+	memoryCache struct {
+		mutex   sync.RWMutex
+		entries map[string][]byte
+	}
+
+	repositoryFileInfo struct {
+		name  string
+		entry DirectoryEntry
+	}
+
+	repositoryFile struct {
+		info repositoryFileInfo
+		*bytes.Reader
+	}
+
+	repositoryDir struct {
+		info    repositoryFileInfo
+		entries []fs.DirEntry
+		offset  int
+	}
+)
+
+// NewRepositoryFS returns an fs.FS over the given repository at the given branch, tag or commit.  cache may be nil,
+// in which case every read fetches the file from Stash.
+func NewRepositoryFS(client Stash, projectKey, repositorySlug, at string, cache ContentCache) *RepositoryFS {
+	return &RepositoryFS{
+		client:         client,
+		projectKey:     projectKey,
+		repositorySlug: repositorySlug,
+		at:             at,
+		cache:          cache,
+		directories:    make(map[string][]DirectoryEntry),
+	}
+}
+
+// NewMemoryCache returns an unbounded in-memory ContentCache.
+func NewMemoryCache() ContentCache {
+	return &memoryCache{entries: make(map[string][]byte)}
+}
+
+// Open opens the named file or directory.
+func (rfs *RepositoryFS) Open(name string) (fs.File, error) {
+	info, err := rfs.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	switch info.entry.Type {
+	case NodeDirectory:
+		entries, err := rfs.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &repositoryDir{info: info, entries: entries}, nil
+	case NodeFile:
+		data, err := rfs.readFile("open", name)
+		if err != nil {
+			return nil, err
+		}
+		return &repositoryFile{info: info, Reader: bytes.NewReader(data)}, nil
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+}
+
+// ReadFile reads the named file without first listing its directory.
+func (rfs *RepositoryFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return rfs.readFile("readfile", name)
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (rfs *RepositoryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	children, err := rfs.browse("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(repositoryFileInfo{name: child.Path.ToString, entry: child}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Stat returns a FileInfo describing the named file or directory.
+func (rfs *RepositoryFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := rfs.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (rfs *RepositoryFS) stat(op, name string) (repositoryFileInfo, error) {
+	if !fs.ValidPath(name) {
+		return repositoryFileInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return repositoryFileInfo{name: ".", entry: DirectoryEntry{Type: NodeDirectory}}, nil
+	}
+	dir, base := path.Split(name)
+	siblings, err := rfs.browse(op, path.Clean(dir))
+	if err != nil {
+		return repositoryFileInfo{}, err
+	}
+	for _, sibling := range siblings {
+		if sibling.Path.ToString == base {
+			return repositoryFileInfo{name: base, entry: sibling}, nil
+		}
+	}
+	return repositoryFileInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (rfs *RepositoryFS) browse(op, name string) ([]DirectoryEntry, error) {
+	rfs.mutex.Lock()
+	entries, ok := rfs.directories[name]
+	rfs.mutex.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	browsePath := name
+	if browsePath == "." {
+		browsePath = ""
+	}
+	entries, err := rfs.client.Browse(rfs.projectKey, rfs.repositorySlug, browsePath, rfs.at)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+
+	rfs.mutex.Lock()
+	rfs.directories[name] = entries
+	rfs.mutex.Unlock()
+	return entries, nil
+}
+
+func (rfs *RepositoryFS) readFile(op, name string) ([]byte, error) {
+	key := rfs.projectKey + "/" + rfs.repositorySlug + "@" + rfs.at + ":" + name
+	if rfs.cache != nil {
+		if data, ok := rfs.cache.Get(key); ok {
+			return data, nil
+		}
+	}
+	data, err := rfs.client.GetRawFile(rfs.projectKey, rfs.repositorySlug, name, rfs.at)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	if rfs.cache != nil {
+		rfs.cache.Put(key, data)
+	}
+	return data, nil
+}
+
+func pathError(op, name string, err error) error {
+	if IsRepositoryNotFound(err) {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (cache *memoryCache) Get(key string) ([]byte, bool) {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	data, ok := cache.entries[key]
+	return data, ok
+}
+
+func (cache *memoryCache) Put(key string, data []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries[key] = data
+}
+
+func (info repositoryFileInfo) Name() string {
+	return info.name
+}
+
+func (info repositoryFileInfo) Size() int64 {
+	return info.entry.Size
+}
+
+func (info repositoryFileInfo) Mode() fs.FileMode {
+	switch info.entry.Type {
+	case NodeDirectory:
+		return fs.ModeDir | 0555
+	case NodeSubmodule:
+		return fs.ModeIrregular | 0444
+	default:
+		return 0444
+	}
+}
+
+// ModTime returns the zero time; Stash does not report modification times in directory listings.
+func (info repositoryFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (info repositoryFileInfo) IsDir() bool {
+	return info.entry.Type == NodeDirectory
+}
+
+// Sys returns the underlying DirectoryEntry.
+func (info repositoryFileInfo) Sys() interface{} {
+	return info.entry
+}
+
+func (file *repositoryFile) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+func (file *repositoryFile) Close() error {
+	return nil
+}
+
+func (dir *repositoryDir) Stat() (fs.FileInfo, error) {
+	return dir.info, nil
+}
+
+func (dir *repositoryDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.info.name, Err: fs.ErrInvalid}
+}
+
+func (dir *repositoryDir) Close() error {
+	return nil
+}
+
+// ReadDir follows the fs.ReadDirFile contract: with n > 0 it returns at most n entries and io.EOF at the end of
+// the directory, otherwise it returns all remaining entries.
+func (dir *repositoryDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := dir.entries[dir.offset:]
+	if n <= 0 {
+		dir.offset = len(dir.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	dir.offset += n
+	return remaining[:n], nil
+}
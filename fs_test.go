@@ -0,0 +1,158 @@
+package stash
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// repositoryTree serves a small repository through the browse and raw file endpoints.
+type repositoryTree struct {
+	t        *testing.T
+	files    map[string]string
+	rawReads map[string]int
+}
+
+func (tree *repositoryTree) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("at") != "def0123abcd" {
+		tree.t.Fatalf("Want at=def0123abcd but found %s\n", r.URL.Query().Get("at"))
+	}
+	if _, ok := r.URL.Query()["raw"]; ok {
+		name := r.URL.Path[strings.Index(r.URL.Path, "/browse/")+len("/browse/"):]
+		content, ok := tree.files[name]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		tree.rawReads[name]++
+		fmt.Fprint(w, content)
+		return
+	}
+
+	dir := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/rest/api/1.0/projects/PROJ/repos/slug/browse"), "/")
+	if _, ok := tree.files[dir]; ok {
+		fmt.Fprint(w, browseFileResponse)
+		return
+	}
+	children := make(map[string]string)
+	for name, content := range tree.files {
+		rest := name
+		if dir != "" {
+			if !strings.HasPrefix(name, dir+"/") {
+				continue
+			}
+			rest = strings.TrimPrefix(name, dir+"/")
+		}
+		if i := strings.Index(rest, "/"); i >= 0 {
+			children[rest[:i]] = fmt.Sprintf(`{"path": {"name": %q, "toString": %q}, "type": "DIRECTORY"}`, rest[:i], rest[:i])
+		} else {
+			children[rest] = fmt.Sprintf(`{"path": {"name": %q, "toString": %q}, "type": "FILE", "size": %d}`, rest, rest, len(content))
+		}
+	}
+	if len(children) == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	values := make([]string, 0, len(children))
+	for _, child := range children {
+		values = append(values, child)
+	}
+	fmt.Fprintf(w, `{"path": {"toString": %q}, "children": {"isLastPage": true, "values": [%s]}}`, dir, strings.Join(values, ","))
+}
+
+func newRepositoryTree(t *testing.T) *repositoryTree {
+	return &repositoryTree{
+		t: t,
+		files: map[string]string{
+			"README.md":                 "hello",
+			"services/billing/pom.xml":  "<project/>",
+			"services/payments/go.mod":  "module payments",
+			"services/payments/main.go": "package main",
+		},
+		rawReads: make(map[string]int),
+	}
+}
+
+func TestRepositoryFS(t *testing.T) {
+	tree := newRepositoryTree(t)
+	testServer := httptest.NewServer(tree)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	repositoryFS := NewRepositoryFS(NewClient("u", "p", url), "PROJ", "slug", "def0123abcd", nil)
+	if err := fstest.TestFS(repositoryFS, "README.md", "services/billing/pom.xml", "services/payments/go.mod", "services/payments/main.go"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepositoryFSWalkDir(t *testing.T) {
+	tree := newRepositoryTree(t)
+	testServer := httptest.NewServer(tree)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	repositoryFS := NewRepositoryFS(NewClient("u", "p", url), "PROJ", "slug", "def0123abcd", nil)
+
+	var found []string
+	err := fs.WalkDir(repositoryFS, "services", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == "go.mod" || d.Name() == "pom.xml" {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if strings.Join(found, ",") != "services/billing/pom.xml,services/payments/go.mod" {
+		t.Fatalf("Want services/billing/pom.xml,services/payments/go.mod but got %v\n", found)
+	}
+}
+
+func TestRepositoryFSNotExist(t *testing.T) {
+	tree := newRepositoryTree(t)
+	testServer := httptest.NewServer(tree)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	repositoryFS := NewRepositoryFS(NewClient("u", "p", url), "PROJ", "slug", "def0123abcd", nil)
+	for _, name := range []string{"missing.txt", "missing/file.txt"} {
+		if _, err := repositoryFS.Open(name); err == nil || !strings.Contains(err.Error(), fs.ErrNotExist.Error()) {
+			t.Fatalf("Want not exist opening %s but got %v\n", name, err)
+		}
+	}
+	if _, err := fs.ReadFile(repositoryFS, "missing.txt"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+	if _, err := repositoryFS.Open("../escape"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestRepositoryFSCache(t *testing.T) {
+	tree := newRepositoryTree(t)
+	testServer := httptest.NewServer(tree)
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	repositoryFS := NewRepositoryFS(NewClient("u", "p", url), "PROJ", "slug", "def0123abcd", NewMemoryCache())
+	for i := 0; i < 3; i++ {
+		data, err := fs.ReadFile(repositoryFS, "services/payments/go.mod")
+		if err != nil {
+			t.Fatalf("Not expecting error: %v\n", err)
+		}
+		if string(data) != "module payments" {
+			t.Fatalf("Want module payments but got %s\n", string(data))
+		}
+	}
+	if tree.rawReads["services/payments/go.mod"] != 1 {
+		t.Fatalf("Want 1 raw read but got %d\n", tree.rawReads["services/payments/go.mod"])
+	}
+}
@@ -93,3 +93,58 @@ func TestGetBranchRestrictions401(t *testing.T) {
 		t.Fatalf("Expecting error but did not get one\n")
 	}
 }
+
+func TestGetBranchRestrictionsPaged(t *testing.T) {
+	pages := []string{`
+{
+  "isLastPage": false,
+  "nextPageStart": 1,
+  "values": [
+    {
+      "id": 41,
+      "type": "BRANCH",
+      "value": "refs/heads/develop",
+      "users": [ { "name": "charlie" } ],
+      "groups": [ "developers" ]
+    }
+  ]
+}
+`, `
+{
+  "isLastPage": true,
+  "values": [
+    {
+      "id": 42,
+      "type": "BRANCH",
+      "value": "refs/heads/master"
+    }
+  ]
+}
+`}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("start") == "0" {
+			fmt.Fprint(w, pages[0])
+		} else {
+			fmt.Fprint(w, pages[1])
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	branchRestrictions, err := stashClient.GetBranchRestrictions("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(branchRestrictions.BranchRestriction) != 2 {
+		t.Fatalf("Want 2 restrictions but got %d\n", len(branchRestrictions.BranchRestriction))
+	}
+	first := branchRestrictions.BranchRestriction[0]
+	if first.Users[0].Name != "charlie" || first.Groups[0] != "developers" {
+		t.Fatalf("Want charlie and developers but got %+v\n", first)
+	}
+	if branchRestrictions.BranchRestriction[1].Id != 42 {
+		t.Fatalf("Want 42 but got %d\n", branchRestrictions.BranchRestriction[1].Id)
+	}
+}
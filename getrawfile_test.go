@@ -2,6 +2,7 @@ package stash
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,7 +16,7 @@ func TestGetRawFile(t *testing.T) {
 		}
 		url := *r.URL
 
-		wantPath := "/projects/prj/repos/repo/browse/foo/bar"
+		wantPath := "/projects/PRJ/repos/REPO/browse/foo/bar"
 		if url.Path != wantPath {
 			t.Fatalf("Want %s but found %s\n", wantPath, url.Path)
 		}
@@ -41,3 +42,80 @@ func TestGetRawFile(t *testing.T) {
 		t.Fatalf("Want hello, but got <%s>\n", string(data))
 	}
 }
+
+func TestOpenRawFile(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+
+		wantPath := "/projects/PRJ/repos/REPO/browse/docs/release%20notes/%23%C3%A9t%C3%A9.md"
+		if url.EscapedPath() != wantPath {
+			t.Fatalf("Want %s but found %s\n", wantPath, url.EscapedPath())
+		}
+		if url.Path != "/projects/PRJ/repos/REPO/browse/docs/release notes/#été.md" {
+			t.Fatalf("Want unescaped path /projects/PRJ/repos/REPO/browse/docs/release notes/#été.md but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want  Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		if params.Get("at") != "refs/tags/v1.0 rc&1" {
+			t.Fatalf("Want refs/tags/v1.0 rc&1 but found %s\n", params["at"])
+		}
+		if _, ok := params["raw"]; !ok {
+			t.Fatalf("Want a raw query param but found none")
+		}
+
+		w.Header().Set("Content-Type", "text/markdown")
+		w.Header().Set("Content-Length", "5")
+		fmt.Fprint(w, "hello")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	rawFile, err := stashClient.OpenRawFile("PRJ", "REPO", "docs/release notes/#été.md", TagRef("v1.0 rc&1"))
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	defer rawFile.Close()
+
+	if rawFile.ContentType != "text/markdown" {
+		t.Fatalf("Want text/markdown but got %s\n", rawFile.ContentType)
+	}
+	if rawFile.Size != 5 {
+		t.Fatalf("Want size 5 but got %d\n", rawFile.Size)
+	}
+	data, err := ioutil.ReadAll(rawFile)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("Want hello, but got <%s>\n", string(data))
+	}
+}
+
+func TestOpenRawFile404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	_, err := stashClient.OpenRawFile("PRJ", "REPO", "missing", "def0123abcd")
+	if !IsRepositoryNotFound(err) {
+		t.Fatalf("Want a not found error but got %v\n", err)
+	}
+}
+
+func TestBranchAndTagRef(t *testing.T) {
+	if BranchRef("main") != "refs/heads/main" || BranchRef("refs/heads/main") != "refs/heads/main" {
+		t.Fatalf("Want refs/heads/main but got %s\n", BranchRef("main"))
+	}
+	if TagRef("v1.0") != "refs/tags/v1.0" || TagRef("refs/tags/v1.0") != "refs/tags/v1.0" {
+		t.Fatalf("Want refs/tags/v1.0 but got %s\n", TagRef("v1.0"))
+	}
+}
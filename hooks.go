@@ -0,0 +1,392 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// Repository hooks and merge checks.  Every method takes a project key and a repository slug; an empty repository
+// slug addresses the project's hook settings, which its repositories inherit unless they override them.
+
+type (
+	Hooks struct {
+		Page
+		Hooks []Hook `json:"values"`
+	}
+
+	// Hook is a hook installed on the server with its state in a project or repository.  Configured is true if
+	// the hook has settings.
+	Hook struct {
+		Details    HookDetails `json:"details"`
+		Enabled    bool        `json:"enabled"`
+		Configured bool        `json:"configured"`
+		Scope      HookScope   `json:"scope"`
+	}
+
+	HookDetails struct {
+		Key           string   `json:"key"`
+		Name          string   `json:"name"`
+		Type          HookType `json:"type"`
+		Description   string   `json:"description"`
+		Version       string   `json:"version"`
+		ConfigFormKey string   `json:"configFormKey"`
+	}
+
+	// HookScope is where the hook state comes from: the PROJECT or the REPOSITORY.
+	HookScope struct {
+		Type       string `json:"type"`
+		ResourceID int    `json:"resourceId"`
+	}
+
+	HookType string
+
+	// HookSettings are the settings of a hook, as returned by GetHookSettings.  Their shape depends on the hook.
+	HookSettings map[string]interface{}
+
+	// HookConfig is a hook to enable, with its settings.  Settings is nil for hooks without settings, and
+	// otherwise anything that marshals to the JSON the hook expects.  See EnsureHooks.
+	HookConfig struct {
+		Key      string
+		Settings interface{}
+	}
+
+	// RequiredCountSettings are the settings of the merge checks that require a number of approvals or builds.
+	RequiredCountSettings struct {
+		RequiredCount int `json:"requiredCount"`
+	}
+
+	// HookChange is a change made by EnsureHooks.
+	HookChange struct {
+		RepositorySlug  string
+		HookKey         string
+		SettingsUpdated bool
+		Enabled         bool
+	}
+)
+
+const (
+	HookPreReceive  HookType = "PRE_RECEIVE"
+	HookPostReceive HookType = "POST_RECEIVE"
+	HookMergeCheck  HookType = "PRE_PULL_REQUEST_MERGE"
+)
+
+// Keys of hooks and merge checks bundled with Bitbucket Server 4.0 and later.  Stash 3.x bundles the same hooks
+// under com.atlassian.stash keys, e.g. com.atlassian.stash.stash-bundled-hooks:force-push-hook; use those keys with
+// the hook methods and in a HookConfig when talking to Stash.
+const (
+	HookKeyRejectForcePush   = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:force-push-hook"
+	HookKeyRequiredApprovers = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:requiredApproversMergeHook"
+	HookKeyIncompleteTasks   = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:incomplete-tasks-merge-check"
+	HookKeyNeedsWork         = "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:needs-work-merge-check"
+	HookKeyRequiredBuilds    = "com.atlassian.bitbucket.server.bitbucket-build:requiredBuildsMergeCheck"
+)
+
+// RejectForcePushHook rejects force pushes.
+func RejectForcePushHook() HookConfig {
+	return HookConfig{Key: HookKeyRejectForcePush}
+}
+
+// RequiredApproversHook blocks merging until the pull request has count approvals.
+func RequiredApproversHook(count int) HookConfig {
+	return HookConfig{Key: HookKeyRequiredApprovers, Settings: RequiredCountSettings{RequiredCount: count}}
+}
+
+// RequiredBuildsHook blocks merging until count builds of the source branch head have succeeded.
+func RequiredBuildsHook(count int) HookConfig {
+	return HookConfig{Key: HookKeyRequiredBuilds, Settings: RequiredCountSettings{RequiredCount: count}}
+}
+
+// IncompleteTasksHook blocks merging while the pull request has open tasks.
+func IncompleteTasksHook() HookConfig {
+	return HookConfig{Key: HookKeyIncompleteTasks}
+}
+
+// NeedsWorkHook blocks merging while a reviewer has marked the pull request as needing work.
+func NeedsWorkHook() HookConfig {
+	return HookConfig{Key: HookKeyNeedsWork}
+}
+
+// GetHooks returns the hooks of the repository, or of the project if repositorySlug is empty.  If hookType is not
+// empty only hooks of that type are returned.
+func (client Client) GetHooks(projectKey, repositorySlug string, hookType HookType) ([]Hook, error) {
+	params := url.Values{}
+	if hookType != "" {
+		params.Set("type", string(hookType))
+	}
+
+	start := 0
+	hooks := make([]Hook, 0)
+	morePages := true
+	for morePages {
+		params.Set("start", fmt.Sprintf("%d", start))
+		params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+		data, err := client.getHookResource("GetHooks", fmt.Sprintf("%s?%s", client.hooksURL(projectKey, repositorySlug), params.Encode()))
+		if err != nil {
+			return nil, err
+		}
+
+		var r Hooks
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, r.Hooks...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return hooks, nil
+}
+
+// GetHook returns the hook with the given key.
+func (client Client) GetHook(projectKey, repositorySlug, hookKey string) (Hook, error) {
+	data, err := client.getHookResource("GetHook", client.hookURL(projectKey, repositorySlug, hookKey))
+	if err != nil {
+		return Hook{}, err
+	}
+	var hook Hook
+	if err := json.Unmarshal(data, &hook); err != nil {
+		return Hook{}, err
+	}
+	return hook, nil
+}
+
+// EnableHook enables the hook with the given key.  A hook that needs settings must have them first; see
+// SetHookSettings.
+func (client Client) EnableHook(projectKey, repositorySlug, hookKey string) (Hook, error) {
+	data, err := client.sendHook("EnableHook", "PUT", client.hookURL(projectKey, repositorySlug, hookKey)+"/enabled", nil)
+	if err != nil {
+		return Hook{}, err
+	}
+	var hook Hook
+	if err := json.Unmarshal(data, &hook); err != nil {
+		return Hook{}, err
+	}
+	return hook, nil
+}
+
+// DisableHook disables the hook with the given key.
+func (client Client) DisableHook(projectKey, repositorySlug, hookKey string) (Hook, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var hook Hook
+	work := func() error {
+		req, err := http.NewRequest("DELETE", client.hookURL(projectKey, repositorySlug, hookKey)+"/enabled", nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.DisableHook %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Is the hook installed?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &hook)
+	}
+
+	if err := retry.Try(work); err != nil {
+		return Hook{}, err
+	}
+	return hook, nil
+}
+
+// GetHookSettings returns the settings of the hook with the given key.  They are empty if the hook has never been
+// configured.
+func (client Client) GetHookSettings(projectKey, repositorySlug, hookKey string) (HookSettings, error) {
+	data, err := client.getHookResource("GetHookSettings", client.hookURL(projectKey, repositorySlug, hookKey)+"/settings")
+	if err != nil {
+		return nil, err
+	}
+	settings := HookSettings{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return settings, nil
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetHookSettings replaces the settings of the hook with the given key.  settings is anything that marshals to the
+// JSON object the hook expects, e.g. HookSettings or RequiredCountSettings.  The hook is not enabled.
+func (client Client) SetHookSettings(projectKey, repositorySlug, hookKey string, settings interface{}) (HookSettings, error) {
+	if settings == nil {
+		return nil, fmt.Errorf("stash: no settings given for hook %s", hookKey)
+	}
+	data, err := client.sendHook("SetHookSettings", "PUT", client.hookURL(projectKey, repositorySlug, hookKey)+"/settings", settings)
+	if err != nil {
+		return nil, err
+	}
+	saved := HookSettings{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// EnsureHooks makes sure each of the hooks is enabled with its settings in each of the repositories of the
+// project.  An empty repository slug addresses the project itself.  Settings are only written if they differ from
+// the current ones and hooks are only enabled if they are disabled, so running it again changes nothing.  On error
+// the changes made so far are returned with it.
+func EnsureHooks(client Stash, projectKey string, repositorySlugs []string, hooks ...HookConfig) ([]HookChange, error) {
+	changes := make([]HookChange, 0)
+	for _, repositorySlug := range repositorySlugs {
+		for _, config := range hooks {
+			change := HookChange{RepositorySlug: repositorySlug, HookKey: config.Key}
+
+			if config.Settings != nil {
+				want, err := toHookSettings(config.Settings)
+				if err != nil {
+					return changes, err
+				}
+				current, err := client.GetHookSettings(projectKey, repositorySlug, config.Key)
+				if err != nil {
+					return changes, err
+				}
+				if !reflect.DeepEqual(current, want) {
+					if _, err := client.SetHookSettings(projectKey, repositorySlug, config.Key, want); err != nil {
+						return changes, err
+					}
+					change.SettingsUpdated = true
+				}
+			}
+
+			hook, err := client.GetHook(projectKey, repositorySlug, config.Key)
+			if err != nil {
+				return changes, err
+			}
+			if !hook.Enabled {
+				if _, err := client.EnableHook(projectKey, repositorySlug, config.Key); err != nil {
+					return changes, err
+				}
+				change.Enabled = true
+			}
+
+			if change.SettingsUpdated || change.Enabled {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// toHookSettings converts settings to the form GetHookSettings returns, so that the two can be compared.
+func toHookSettings(settings interface{}) (HookSettings, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	s := HookSettings{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("stash: hook settings must be a JSON object: %v", err)
+	}
+	return s, nil
+}
+
+func (client Client) sendHook(operation, method, hookURL string, body interface{}) ([]byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, hookURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-type", "application/json")
+	}
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return nil, err
+	}
+	if responseCode != http.StatusOK {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The hook settings were not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage hooks."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  Is the hook installed?"
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return nil, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+	return data, nil
+}
+
+// getHookResource GETs a hook resource, retrying on failure.  A 204 response yields an empty body.
+func (client Client) getHookResource(operation, resourceURL string) ([]byte, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var data []byte
+	work := func() error {
+		req, err := http.NewRequest("GET", resourceURL, nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		var responseCode int
+		responseCode, data, err = consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK && responseCode != http.StatusNoContent {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Is the hook installed?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+		return nil
+	}
+
+	return data, retry.Try(work)
+}
+
+func (client Client) hooksURL(projectKey, repositorySlug string) string {
+	if repositorySlug == "" {
+		return fmt.Sprintf("%s/rest/api/1.0/projects/%s/settings/hooks", client.baseURL.String(), projectKey)
+	}
+	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/settings/hooks", client.baseURL.String(), projectKey, repositorySlug)
+}
+
+func (client Client) hookURL(projectKey, repositorySlug, hookKey string) string {
+	return fmt.Sprintf("%s/%s", client.hooksURL(projectKey, repositorySlug), url.PathEscape(hookKey))
+}
@@ -0,0 +1,222 @@
+package stash
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const hookResponse string = `
+{
+	"details": {
+		"key": "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:requiredApproversMergeHook",
+		"name": "Minimum approvals",
+		"type": "PRE_PULL_REQUEST_MERGE",
+		"description": "Requires a minimum number of approvals",
+		"version": "5.0.0",
+		"configFormKey": "com.atlassian.bitbucket.server.bitbucket-bundled-hooks:requiredApproversMergeHook-config"
+	},
+	"enabled": %t,
+	"configured": true,
+	"scope": {"type": "REPOSITORY", "resourceId": 84}
+}
+`
+
+func TestGetHooks(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/settings/hooks" {
+			t.Fatalf("GetHooks() URL path expected to be /rest/api/1.0/projects/PROJ/settings/hooks but found %s\n", url.Path)
+		}
+		if url.Query().Get("type") != "PRE_PULL_REQUEST_MERGE" {
+			t.Fatalf("Want type PRE_PULL_REQUEST_MERGE but got %s\n", url.RawQuery)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		switch url.Query().Get("start") {
+		case "0":
+			fmt.Fprintf(w, `{"isLastPage": false, "nextPageStart": 1, "values": [`+hookResponse+`]}`, true)
+		case "1":
+			fmt.Fprintf(w, `{"isLastPage": true, "values": [`+hookResponse+`]}`, false)
+		default:
+			t.Fatalf("Unexpected query %s\n", url.RawQuery)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	hooks, err := stashClient.GetHooks("PROJ", "", HookMergeCheck)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(hooks) != 2 || !hooks[0].Enabled || hooks[1].Enabled || hooks[0].Details.Key != HookKeyRequiredApprovers || hooks[0].Scope.ResourceID != 84 {
+		t.Fatalf("Unexpected hooks %+v\n", hooks)
+	}
+}
+
+func TestEnableAndDisableHook(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/settings/hooks/com.atlassian.bitbucket.server.bitbucket-bundled-hooks:requiredApproversMergeHook/enabled" {
+			t.Fatalf("Unexpected URL path %s\n", url.Path)
+		}
+		switch r.Method {
+		case "PUT":
+			fmt.Fprintf(w, hookResponse, true)
+		case "DELETE":
+			fmt.Fprintf(w, hookResponse, false)
+		default:
+			t.Fatalf("Unexpected method %s\n", r.Method)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	hook, err := stashClient.EnableHook("PROJ", "slug", HookKeyRequiredApprovers)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if !hook.Enabled {
+		t.Fatalf("Want the hook enabled but got %+v\n", hook)
+	}
+	hook, err = stashClient.DisableHook("PROJ", "slug", HookKeyRequiredApprovers)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if hook.Enabled {
+		t.Fatalf("Want the hook disabled but got %+v\n", hook)
+	}
+}
+
+func TestHookSettings(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/settings/hooks/com.atlassian.bitbucket.server.bitbucket-build:requiredBuildsMergeCheck/settings" {
+			t.Fatalf("Unexpected URL path %s\n", url.Path)
+		}
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(204)
+		case "PUT":
+			if r.Header.Get("Content-type") != "application/json" {
+				t.Fatalf("Want Content-type application/json but found %s\n", r.Header.Get("Content-type"))
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			if string(data) != `{"requiredCount":2}` {
+				t.Fatalf("Unexpected request body %s\n", data)
+			}
+			fmt.Fprint(w, `{"requiredCount": 2}`)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	settings, err := stashClient.GetHookSettings("PROJ", "slug", HookKeyRequiredBuilds)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(settings) != 0 {
+		t.Fatalf("Want no settings but got %v\n", settings)
+	}
+	settings, err = stashClient.SetHookSettings("PROJ", "slug", HookKeyRequiredBuilds, RequiredCountSettings{RequiredCount: 2})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if settings["requiredCount"] != float64(2) {
+		t.Fatalf("Want requiredCount 2 but got %v\n", settings)
+	}
+}
+
+func TestGetHook404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetHook("PROJ", "slug", "no.such:hook"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestEnsureHooks(t *testing.T) {
+	// repo1 has the approvals check enabled with the wanted settings; repo2 has it disabled with other settings.
+	// Neither has force pushes rejected.
+	var requests []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo1/settings/hooks/" + HookKeyRequiredApprovers + "/settings":
+			fmt.Fprint(w, `{"requiredCount": 2}`)
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo1/settings/hooks/" + HookKeyRequiredApprovers:
+			fmt.Fprintf(w, hookResponse, true)
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRequiredApprovers + "/settings":
+			fmt.Fprint(w, `{"requiredCount": 1}`)
+		case "PUT /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRequiredApprovers + "/settings":
+			fmt.Fprint(w, `{"requiredCount": 2}`)
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRequiredApprovers:
+			fmt.Fprintf(w, hookResponse, false)
+		case "PUT /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRequiredApprovers + "/enabled":
+			fmt.Fprintf(w, hookResponse, true)
+		case "GET /rest/api/1.0/projects/PROJ/repos/repo1/settings/hooks/" + HookKeyRejectForcePush,
+			"GET /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRejectForcePush:
+			fmt.Fprint(w, `{"details": {"key": "`+HookKeyRejectForcePush+`"}, "enabled": false}`)
+		case "PUT /rest/api/1.0/projects/PROJ/repos/repo1/settings/hooks/" + HookKeyRejectForcePush + "/enabled",
+			"PUT /rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/" + HookKeyRejectForcePush + "/enabled":
+			fmt.Fprint(w, `{"details": {"key": "`+HookKeyRejectForcePush+`"}, "enabled": true}`)
+		default:
+			t.Fatalf("Unexpected request %s %s\n", r.Method, r.URL.Path)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	changes, err := EnsureHooks(stashClient, "PROJ", []string{"repo1", "repo2"}, RequiredApproversHook(2), RejectForcePushHook())
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	want := []HookChange{
+		{RepositorySlug: "repo1", HookKey: HookKeyRejectForcePush, Enabled: true},
+		{RepositorySlug: "repo2", HookKey: HookKeyRequiredApprovers, SettingsUpdated: true, Enabled: true},
+		{RepositorySlug: "repo2", HookKey: HookKeyRejectForcePush, Enabled: true},
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Fatalf("Want changes %v but got %v\n", want, changes)
+	}
+	if len(requests) != 10 {
+		t.Fatalf("Want 10 requests but got %v\n", requests)
+	}
+}
+
+func TestEnsureHooksStopsOnError(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rest/api/1.0/projects/PROJ/repos/repo2/settings/hooks/"+HookKeyRejectForcePush {
+			w.WriteHeader(404)
+			return
+		}
+		if r.Method != "GET" {
+			t.Fatalf("Want no changes but got %s %s\n", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"enabled": true}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	changes, err := EnsureHooks(stashClient, "PROJ", []string{"repo1", "repo2", "repo3"}, RejectForcePushHook())
+	if err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Want no changes but got %v\n", changes)
+	}
+}
@@ -0,0 +1,426 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	InsightResult      string
+	InsightDataType    string
+	AnnotationSeverity string
+	AnnotationType     string
+
+	InsightReports struct {
+		Page
+		InsightReports []InsightReport `json:"values"`
+	}
+
+	// InsightReport is a Code Insights report against a commit, shown on pull requests that include the commit.
+	InsightReport struct {
+		Key         string        `json:"key,omitempty"`
+		Title       string        `json:"title"`
+		Details     string        `json:"details,omitempty"`
+		Result      InsightResult `json:"result,omitempty"`
+		Data        []InsightData `json:"data,omitempty"`
+		Reporter    string        `json:"reporter,omitempty"`
+		Link        string        `json:"link,omitempty"`
+		LogoURL     string        `json:"logoUrl,omitempty"`
+		CreatedDate int64         `json:"createdDate,omitempty"`
+	}
+
+	// InsightData is a field shown on a report.  Value is a bool, number, string or, for InsightDataLink, an
+	// InsightLink, as the type requires.
+	InsightData struct {
+		Title string          `json:"title"`
+		Type  InsightDataType `json:"type,omitempty"`
+		Value interface{}     `json:"value"`
+	}
+
+	InsightLink struct {
+		LinkText string `json:"linktext,omitempty"`
+		Href     string `json:"href"`
+	}
+
+	InsightAnnotations struct {
+		Annotations []InsightAnnotation `json:"annotations"`
+		TotalCount  int                 `json:"totalCount,omitempty"`
+	}
+
+	// InsightAnnotation marks a line of a file with a finding.  A Line of 0 annotates the whole file.
+	InsightAnnotation struct {
+		ReportKey  string             `json:"reportKey,omitempty"`
+		ExternalID string             `json:"externalId,omitempty"`
+		Path       string             `json:"path"`
+		Line       int                `json:"line"`
+		Message    string             `json:"message"`
+		Severity   AnnotationSeverity `json:"severity"`
+		Type       AnnotationType     `json:"type,omitempty"`
+		Link       string             `json:"link,omitempty"`
+	}
+)
+
+const (
+	InsightPass InsightResult = "PASS"
+	InsightFail InsightResult = "FAIL"
+)
+
+const (
+	InsightDataBoolean    InsightDataType = "BOOLEAN"
+	InsightDataDate       InsightDataType = "DATE"
+	InsightDataDuration   InsightDataType = "DURATION"
+	InsightDataLink       InsightDataType = "LINK"
+	InsightDataNumber     InsightDataType = "NUMBER"
+	InsightDataPercentage InsightDataType = "PERCENTAGE"
+	InsightDataText       InsightDataType = "TEXT"
+)
+
+const (
+	SeverityLow    AnnotationSeverity = "LOW"
+	SeverityMedium AnnotationSeverity = "MEDIUM"
+	SeverityHigh   AnnotationSeverity = "HIGH"
+)
+
+const (
+	AnnotationVulnerability AnnotationType = "VULNERABILITY"
+	AnnotationCodeSmell     AnnotationType = "CODE_SMELL"
+	AnnotationBug           AnnotationType = "BUG"
+)
+
+// Server-side Code Insights limits.  Requests exceeding them are refused before they are sent.
+const (
+	MaxInsightReportTitleLength       = 450
+	MaxInsightReportDetailsLength     = 2000
+	MaxInsightReportDataFields        = 6
+	MaxInsightAnnotationsPerReport    = 1000
+	MaxInsightAnnotationMessageLength = 2000
+	MaxInsightExternalIDLength        = 450
+)
+
+// SetInsightReport creates the report with the given key against the commit, or replaces it if it exists.
+// Replacing a report deletes its annotations.
+func (client Client) SetInsightReport(projectKey, repositorySlug, commitID, key string, report InsightReport) (InsightReport, error) {
+	if err := report.validate(); err != nil {
+		return InsightReport{}, err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return InsightReport{}, err
+	}
+
+	req, err := http.NewRequest("PUT", client.insightReportURL(projectKey, repositorySlug, commitID, key), bytes.NewReader(data))
+	if err != nil {
+		return InsightReport{}, err
+	}
+	Log.Printf("stash.SetInsightReport %s\n", req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return InsightReport{}, err
+	}
+	if responseCode != http.StatusOK {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The report was not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to report on the repository."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the repository exist?  The commit?"
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return InsightReport{}, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+
+	var t InsightReport
+	if err := json.Unmarshal(data, &t); err != nil {
+		return InsightReport{}, err
+	}
+	return t, nil
+}
+
+// GetInsightReport returns the report with the given key.
+func (client Client) GetInsightReport(projectKey, repositorySlug, commitID, key string) (InsightReport, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var report InsightReport
+	work := func() error {
+		req, err := http.NewRequest("GET", client.insightReportURL(projectKey, repositorySlug, commitID, key), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetInsightReport %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &report)
+	}
+
+	return report, retry.Try(work)
+}
+
+// GetInsightReports returns every report against the commit.
+func (client Client) GetInsightReports(projectKey, repositorySlug, commitID string) ([]InsightReport, error) {
+	start := 0
+	reports := make([]InsightReport, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/insights/1.0/projects/%s/repos/%s/commits/%s/reports?start=%d&limit=%d", client.baseURL.String(), projectKey, repositorySlug, commitID, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetInsightReports %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r InsightReports
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r.InsightReports...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return reports, nil
+}
+
+// DeleteInsightReport deletes the report with the given key and its annotations.
+func (client Client) DeleteInsightReport(projectKey, repositorySlug, commitID, key string) error {
+	return client.deleteInsights("DeleteInsightReport", client.insightReportURL(projectKey, repositorySlug, commitID, key))
+}
+
+// AddInsightAnnotations adds annotations to the report with the given key in a single request.  The report's
+// existing annotations are fetched first so that the MaxInsightAnnotationsPerReport limit covers the whole report.
+func (client Client) AddInsightAnnotations(projectKey, repositorySlug, commitID, key string, annotations []InsightAnnotation) error {
+	if err := validateAnnotations(annotations, 0); err != nil {
+		return err
+	}
+	existing, err := client.GetInsightAnnotations(projectKey, repositorySlug, commitID, key)
+	if err != nil {
+		return err
+	}
+	if err := validateAnnotations(annotations, len(existing)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(InsightAnnotations{Annotations: annotations})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", client.insightReportURL(projectKey, repositorySlug, commitID, key)+"/annotations", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	Log.Printf("stash.AddInsightAnnotations %s\n", req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return err
+	}
+
+	switch responseCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusBadRequest:
+		return errorResponse{StatusCode: responseCode, Reason: strings.TrimSpace("The annotations were not added due to a validation error.  " + serverMessage(data))}
+	case http.StatusUnauthorized:
+		return errorResponse{StatusCode: responseCode, Reason: "Unauthorized"}
+	case http.StatusNotFound:
+		return errorResponse{StatusCode: responseCode, Reason: "Not found.  Does the report exist?"}
+	default:
+		return errorResponse{StatusCode: responseCode, Reason: "(unhandled reason)"}
+	}
+}
+
+// GetInsightAnnotations returns the annotations of the report with the given key.
+func (client Client) GetInsightAnnotations(projectKey, repositorySlug, commitID, key string) ([]InsightAnnotation, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var annotations InsightAnnotations
+	work := func() error {
+		req, err := http.NewRequest("GET", client.insightReportURL(projectKey, repositorySlug, commitID, key)+"/annotations", nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetInsightAnnotations %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &annotations)
+	}
+
+	return annotations.Annotations, retry.Try(work)
+}
+
+// DeleteInsightAnnotations deletes every annotation of the report with the given key.
+func (client Client) DeleteInsightAnnotations(projectKey, repositorySlug, commitID, key string) error {
+	return client.deleteInsights("DeleteInsightAnnotations", client.insightReportURL(projectKey, repositorySlug, commitID, key)+"/annotations")
+}
+
+func (client Client) deleteInsights(operation, insightsURL string) error {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		req, err := http.NewRequest("DELETE", insightsURL, nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+func (client Client) insightReportURL(projectKey, repositorySlug, commitID, key string) string {
+	return fmt.Sprintf("%s/rest/insights/1.0/projects/%s/repos/%s/commits/%s/reports/%s", client.baseURL.String(), projectKey, repositorySlug, commitID, url.PathEscape(key))
+}
+
+func (report InsightReport) validate() error {
+	var problems []string
+	if report.Title == "" {
+		problems = append(problems, "title is required")
+	}
+	if utf8.RuneCountInString(report.Title) > MaxInsightReportTitleLength {
+		problems = append(problems, fmt.Sprintf("title is longer than %d characters", MaxInsightReportTitleLength))
+	}
+	if utf8.RuneCountInString(report.Details) > MaxInsightReportDetailsLength {
+		problems = append(problems, fmt.Sprintf("details are longer than %d characters", MaxInsightReportDetailsLength))
+	}
+	if len(report.Data) > MaxInsightReportDataFields {
+		problems = append(problems, fmt.Sprintf("%d data fields exceed the limit of %d", len(report.Data), MaxInsightReportDataFields))
+	}
+	return insightsValidationError(problems)
+}
+
+// validateAnnotations checks annotations about to be added to a report that already holds existing annotations.
+func validateAnnotations(annotations []InsightAnnotation, existing int) error {
+	var problems []string
+	if existing+len(annotations) > MaxInsightAnnotationsPerReport {
+		problems = append(problems, fmt.Sprintf("%d new and %d existing annotations exceed the limit of %d per report", len(annotations), existing, MaxInsightAnnotationsPerReport))
+	}
+	for i, annotation := range annotations {
+		if annotation.Path == "" {
+			problems = append(problems, fmt.Sprintf("annotation %d has no path", i))
+		}
+		if path.IsAbs(annotation.Path) {
+			problems = append(problems, fmt.Sprintf("annotation %d path %s is not relative to the repository root", i, annotation.Path))
+		}
+		if annotation.Message == "" {
+			problems = append(problems, fmt.Sprintf("annotation %d has no message", i))
+		}
+		if utf8.RuneCountInString(annotation.Message) > MaxInsightAnnotationMessageLength {
+			problems = append(problems, fmt.Sprintf("annotation %d message is longer than %d characters", i, MaxInsightAnnotationMessageLength))
+		}
+		if utf8.RuneCountInString(annotation.ExternalID) > MaxInsightExternalIDLength {
+			problems = append(problems, fmt.Sprintf("annotation %d external id is longer than %d characters", i, MaxInsightExternalIDLength))
+		}
+		if annotation.Severity == "" {
+			problems = append(problems, fmt.Sprintf("annotation %d has no severity", i))
+		}
+		if annotation.Line < 0 {
+			problems = append(problems, fmt.Sprintf("annotation %d has a negative line number", i))
+		}
+	}
+	return insightsValidationError(problems)
+}
+
+func insightsValidationError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("code insights: %s", strings.Join(problems, "; "))
+}
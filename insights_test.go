@@ -0,0 +1,281 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const insightReportResponse string = `
+{
+	"key": "sonar",
+	"title": "Static analysis",
+	"details": "2 new issues",
+	"result": "FAIL",
+	"reporter": "SonarQube",
+	"link": "https://sonar.example.com/project",
+	"createdDate": 1420070400000,
+	"data": [
+		{ "title": "Coverage", "type": "PERCENTAGE", "value": 84.5 },
+		{ "title": "Report", "type": "LINK", "value": { "linktext": "Full report", "href": "https://sonar.example.com/report" } }
+	]
+}
+`
+
+func TestSetInsightReport(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar" {
+			t.Fatalf("SetInsightReport() URL path expected to be /rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar but found %s\n", url.Path)
+		}
+		if r.Header.Get("Content-type") != "application/json" {
+			t.Fatalf("Want Content-type application/json but found %s\n", r.Header.Get("Content-type"))
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var report map[string]interface{}
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if report["title"] != "Static analysis" || report["result"] != "FAIL" {
+			t.Fatalf("Want title and result but got %v\n", report)
+		}
+		link := report["data"].([]interface{})[1].(map[string]interface{})["value"].(map[string]interface{})
+		if link["href"] != "https://sonar.example.com/report" {
+			t.Fatalf("Want a link value but got %v\n", link)
+		}
+		fmt.Fprint(w, insightReportResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	report := InsightReport{
+		Title:    "Static analysis",
+		Details:  "2 new issues",
+		Result:   InsightFail,
+		Reporter: "SonarQube",
+		Link:     "https://sonar.example.com/project",
+		Data: []InsightData{
+			{Title: "Coverage", Type: InsightDataPercentage, Value: 84.5},
+			{Title: "Report", Type: InsightDataLink, Value: InsightLink{LinkText: "Full report", Href: "https://sonar.example.com/report"}},
+		},
+	}
+	saved, err := stashClient.SetInsightReport("PROJ", "slug", "def0123abcd", "sonar", report)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if saved.Key != "sonar" || saved.CreatedDate != 1420070400000 {
+		t.Fatalf("Want the saved report but got %+v\n", saved)
+	}
+}
+
+func TestSetInsightReportValidation(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request for an invalid report\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	reports := []InsightReport{
+		{},
+		{Title: strings.Repeat("t", MaxInsightReportTitleLength+1)},
+		{Title: "ok", Details: strings.Repeat("d", MaxInsightReportDetailsLength+1)},
+		{Title: "ok", Data: make([]InsightData, MaxInsightReportDataFields+1)},
+	}
+	for _, report := range reports {
+		if _, err := stashClient.SetInsightReport("PROJ", "slug", "def0123abcd", "sonar", report); err == nil {
+			t.Fatalf("Expecting error but did not get one\n")
+		}
+	}
+}
+
+func TestGetInsightReports(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports" {
+			t.Fatalf("GetInsightReports() URL path expected to be /rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports but found %s\n", url.Path)
+		}
+		fmt.Fprintf(w, `{"isLastPage": true, "values": [%s]}`, insightReportResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	reports, err := stashClient.GetInsightReports("PROJ", "slug", "def0123abcd")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(reports) != 1 || reports[0].Result != InsightFail {
+		t.Fatalf("Want 1 failed report but got %+v\n", reports)
+	}
+}
+
+func TestGetInsightReport404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetInsightReport("PROJ", "slug", "def0123abcd", "sonar"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestDeleteInsightReport(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar" {
+			t.Fatalf("DeleteInsightReport() URL path expected to be /rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar but found %s\n", r.URL.Path)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteInsightReport("PROJ", "slug", "def0123abcd", "sonar"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestAddInsightAnnotations(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `{"totalCount": 0, "annotations": []}`)
+			return
+		}
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar/annotations" {
+			t.Fatalf("AddInsightAnnotations() URL path expected to be /rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar/annotations but found %s\n", r.URL.Path)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var annotations InsightAnnotations
+		if err := json.Unmarshal(data, &annotations); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if len(annotations.Annotations) != 2 || annotations.Annotations[1].Type != AnnotationBug {
+			t.Fatalf("Want 2 annotations, the second a bug, but got %+v\n", annotations)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	annotations := []InsightAnnotation{
+		{Path: "src/App.java", Line: 12, Message: "Unused import", Severity: SeverityLow, Type: AnnotationCodeSmell},
+		{Path: "src/App.java", Line: 40, Message: "Possible null dereference", Severity: SeverityHigh, Type: AnnotationBug},
+	}
+	if err := stashClient.AddInsightAnnotations("PROJ", "slug", "def0123abcd", "sonar", annotations); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestAddInsightAnnotationsValidation(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request for invalid annotations\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+
+	tooMany := make([]InsightAnnotation, MaxInsightAnnotationsPerReport+1)
+	for i := range tooMany {
+		tooMany[i] = InsightAnnotation{Path: "a", Line: i, Message: "m", Severity: SeverityLow}
+	}
+	for _, annotations := range [][]InsightAnnotation{
+		tooMany,
+		{{Path: "a", Line: 1, Severity: SeverityLow}},
+		{{Path: "a", Line: 1, Message: strings.Repeat("m", MaxInsightAnnotationMessageLength+1), Severity: SeverityLow}},
+		{{Path: "a", Line: 1, Message: "m"}},
+		{{Path: "a", Line: -1, Message: "m", Severity: SeverityLow}},
+		{{Line: 1, Message: "m", Severity: SeverityLow}},
+		{{Path: "/src/App.java", Line: 1, Message: "m", Severity: SeverityLow}},
+	} {
+		if err := stashClient.AddInsightAnnotations("PROJ", "slug", "def0123abcd", "sonar", annotations); err == nil {
+			t.Fatalf("Expecting error but did not get one\n")
+		}
+	}
+}
+
+func TestAddInsightAnnotationsReportLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("Want no POST once the report is full but got %s\n", r.Method)
+		}
+		existing := make([]InsightAnnotation, MaxInsightAnnotationsPerReport)
+		for i := range existing {
+			existing[i] = InsightAnnotation{Path: "a", Line: i, Message: "m", Severity: SeverityLow}
+		}
+		json.NewEncoder(w).Encode(InsightAnnotations{Annotations: existing, TotalCount: len(existing)})
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	annotations := []InsightAnnotation{{Path: "a", Line: 1, Message: "m", Severity: SeverityLow}}
+	if err := stashClient.AddInsightAnnotations("PROJ", "slug", "def0123abcd", "sonar", annotations); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestGetInsightAnnotations(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar/annotations" {
+			t.Fatalf("GetInsightAnnotations() URL path expected to be /rest/insights/1.0/projects/PROJ/repos/slug/commits/def0123abcd/reports/sonar/annotations but found %s\n", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"totalCount": 1, "annotations": [{"reportKey": "sonar", "path": "src/App.java", "line": 12, "message": "Unused import", "severity": "LOW", "type": "CODE_SMELL"}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	annotations, err := stashClient.GetInsightAnnotations("PROJ", "slug", "def0123abcd", "sonar")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(annotations) != 1 || annotations[0].Severity != SeverityLow || annotations[0].ReportKey != "sonar" {
+		t.Fatalf("Want 1 low severity annotation but got %+v\n", annotations)
+	}
+}
+
+func TestDeleteInsightAnnotations(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteInsightAnnotations("PROJ", "slug", "def0123abcd", "sonar"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
@@ -0,0 +1,164 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const listBranchesPage1 string = `
+{
+   "isLastPage" : false,
+   "nextPageStart" : 1,
+   "values" : [
+      {
+         "displayId" : "release/2.0",
+         "isDefault" : false,
+         "latestChangeset" : "e680a10f3e0afb5e3a5978dea02d37ac884da21",
+         "id" : "refs/heads/release/2.0",
+         "metadata" : {
+            "com.atlassian.stash.stash-branch-utils:ahead-behind-metadata-provider" : {
+               "ahead" : 3,
+               "behind" : 7
+            },
+            "com.atlassian.stash.stash-branch-utils:latest-changeset-metadata" : {
+               "id" : "e680a10f3e0afb5e3a5978dea02d37ac884da21",
+               "displayId" : "e680a10f3e0",
+               "author" : {
+                  "name" : "charlie",
+                  "emailAddress" : "charlie@example.com"
+               },
+               "authorTimestamp" : 1420070400000,
+               "message" : "Bump version"
+            },
+            "com.atlassian.stash.stash-ref-metadata-plugin:outgoing-pull-request-metadata" : {
+               "pullRequest" : {
+                  "id" : 12,
+                  "state" : "OPEN",
+                  "title" : "Release 2.0"
+               }
+            },
+            "com.example.unknown:provider" : {}
+         }
+      }
+   ],
+   "limit" : 1,
+   "start" : 0,
+   "size" : 1
+}
+`
+
+const listBranchesPage2 string = `
+{
+   "isLastPage" : true,
+   "values" : [
+      {
+         "displayId" : "release/1.0",
+         "isDefault" : false,
+         "latestChangeset" : "8d0f23745dfe4bacef9509bb4ecd7722b9aff82",
+         "id" : "refs/heads/release/1.0"
+      }
+   ],
+   "limit" : 1,
+   "start" : 1,
+   "size" : 1
+}
+`
+
+func TestListBranches(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PRJ/repos/widge/branches" {
+			t.Fatalf("ListBranches() URL path expected to be /rest/api/1.0/projects/PRJ/repos/widge/branches but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		for k, v := range map[string]string{"filterText": "release/", "orderBy": "MODIFICATION", "base": "refs/heads/master", "details": "true"} {
+			if params.Get(k) != v {
+				t.Fatalf("Want %s=%s but found %s\n", k, v, params.Get(k))
+			}
+		}
+		if params.Get("start") == "0" {
+			fmt.Fprint(w, listBranchesPage1)
+		} else {
+			fmt.Fprint(w, listBranchesPage2)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	options := BranchListOptions{FilterText: "release/", OrderBy: BranchOrderModification, Base: "master", Details: true}
+	branches, err := stashClient.ListBranches("PRJ", "widge", options)
+	if err != nil {
+		t.Fatalf("ListBranches() not expecting an error, but received: %v\n", err)
+	}
+
+	if len(branches) != 2 {
+		t.Fatalf("Want 2 branches but got %d\n", len(branches))
+	}
+	if branches[0].DisplayID != "release/2.0" || branches[1].DisplayID != "release/1.0" {
+		t.Fatalf("Want branches in server order but got %s, %s\n", branches[0].DisplayID, branches[1].DisplayID)
+	}
+
+	metadata := branches[0].Metadata
+	if metadata.AheadBehind == nil || metadata.AheadBehind.Ahead != 3 || metadata.AheadBehind.Behind != 7 {
+		t.Fatalf("Want ahead 3 behind 7 but got %+v\n", metadata.AheadBehind)
+	}
+	if metadata.LatestCommit == nil || metadata.LatestCommit.Author.Name != "charlie" {
+		t.Fatalf("Want latest commit by charlie but got %+v\n", metadata.LatestCommit)
+	}
+	if metadata.LatestCommit.AuthorTime().Unix() != 1420070400 {
+		t.Fatalf("Want author time 1420070400 but got %d\n", metadata.LatestCommit.AuthorTime().Unix())
+	}
+	if metadata.OutgoingPullRequest == nil || metadata.OutgoingPullRequest.ID != 12 {
+		t.Fatalf("Want outgoing pull request 12 but got %+v\n", metadata.OutgoingPullRequest)
+	}
+
+	if branches[1].Metadata.AheadBehind != nil || branches[1].Metadata.LatestCommit != nil {
+		t.Fatalf("Want no metadata on release/1.0 but got %+v\n", branches[1].Metadata)
+	}
+}
+
+func TestListBranchesNoOptions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		for _, k := range []string{"filterText", "orderBy", "base", "details"} {
+			if _, ok := params[k]; ok {
+				t.Fatalf("Want no %s query param but found one\n", k)
+			}
+		}
+		fmt.Fprint(w, listBranchesPage2)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	branches, err := stashClient.ListBranches("PRJ", "widge", BranchListOptions{})
+	if err != nil {
+		t.Fatalf("ListBranches() not expecting an error, but received: %v\n", err)
+	}
+	if len(branches) != 1 {
+		t.Fatalf("Want 1 branch but got %d\n", len(branches))
+	}
+}
+
+func TestListBranches400(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.ListBranches("PRJ", "widge", BranchListOptions{OrderBy: "SIDEWAYS"}); err == nil {
+		t.Fatalf("ListBranches() expecting an error but received none\n")
+	}
+}
@@ -0,0 +1,376 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// Repository, project and global permissions.  The repository and project methods take a project key and a
+// repository slug; an empty repository slug addresses the permissions of the project itself.
+
+type (
+	Permission string
+
+	UserPermissions struct {
+		Page
+		UserPermissions []UserPermission `json:"values"`
+	}
+
+	UserPermission struct {
+		User       User       `json:"user"`
+		Permission Permission `json:"permission"`
+	}
+
+	GroupPermissions struct {
+		Page
+		GroupPermissions []GroupPermission `json:"values"`
+	}
+
+	GroupPermission struct {
+		Group      PermittedGroup `json:"group"`
+		Permission Permission     `json:"permission"`
+	}
+
+	PermittedGroup struct {
+		Name string `json:"name"`
+	}
+)
+
+const (
+	PermissionLicensedUser  Permission = "LICENSED_USER"
+	PermissionProjectCreate Permission = "PROJECT_CREATE"
+	PermissionAdmin         Permission = "ADMIN"
+	PermissionSysAdmin      Permission = "SYS_ADMIN"
+)
+
+const (
+	PermissionProjectView  Permission = "PROJECT_VIEW"
+	PermissionProjectRead  Permission = "PROJECT_READ"
+	PermissionProjectWrite Permission = "PROJECT_WRITE"
+	PermissionProjectAdmin Permission = "PROJECT_ADMIN"
+)
+
+const (
+	PermissionRepoRead  Permission = "REPO_READ"
+	PermissionRepoWrite Permission = "REPO_WRITE"
+	PermissionRepoAdmin Permission = "REPO_ADMIN"
+)
+
+// IsGlobal reports whether p is a global permission such as LICENSED_USER or ADMIN.
+func (p Permission) IsGlobal() bool {
+	switch p {
+	case PermissionLicensedUser, PermissionProjectCreate, PermissionAdmin, PermissionSysAdmin:
+		return true
+	}
+	return false
+}
+
+// IsProject reports whether p is a project permission that can be granted.  PROJECT_VIEW is not: the server
+// reports it for users who can see a project only through a repository permission.
+func (p Permission) IsProject() bool {
+	switch p {
+	case PermissionProjectRead, PermissionProjectWrite, PermissionProjectAdmin:
+		return true
+	}
+	return false
+}
+
+// IsRepository reports whether p is a REPO_* permission.
+func (p Permission) IsRepository() bool {
+	return strings.HasPrefix(string(p), "REPO_")
+}
+
+// GetUserPermissions returns the users granted a permission on the repository, or on the project if repositorySlug
+// is empty.
+func (client Client) GetUserPermissions(projectKey, repositorySlug string) ([]UserPermission, error) {
+	permissions := make([]UserPermission, 0)
+	err := client.getPermissionPages("GetUserPermissions", client.permissionsURL(projectKey, repositorySlug, "users"), func(data []byte) (Page, error) {
+		var r UserPermissions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return Page{}, err
+		}
+		permissions = append(permissions, r.UserPermissions...)
+		return r.Page, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetGroupPermissions returns the groups granted a permission on the repository, or on the project if
+// repositorySlug is empty.
+func (client Client) GetGroupPermissions(projectKey, repositorySlug string) ([]GroupPermission, error) {
+	permissions := make([]GroupPermission, 0)
+	err := client.getPermissionPages("GetGroupPermissions", client.permissionsURL(projectKey, repositorySlug, "groups"), func(data []byte) (Page, error) {
+		var r GroupPermissions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return Page{}, err
+		}
+		permissions = append(permissions, r.GroupPermissions...)
+		return r.Page, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetGlobalUserPermissions returns the users granted a global permission.  Listing global permissions requires the
+// ADMIN permission.
+func (client Client) GetGlobalUserPermissions() ([]UserPermission, error) {
+	permissions := make([]UserPermission, 0)
+	err := client.getPermissionPages("GetGlobalUserPermissions", fmt.Sprintf("%s/rest/api/1.0/admin/permissions/users", client.baseURL.String()), func(data []byte) (Page, error) {
+		var r UserPermissions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return Page{}, err
+		}
+		permissions = append(permissions, r.UserPermissions...)
+		return r.Page, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetGlobalGroupPermissions returns the groups granted a global permission.
+func (client Client) GetGlobalGroupPermissions() ([]GroupPermission, error) {
+	permissions := make([]GroupPermission, 0)
+	err := client.getPermissionPages("GetGlobalGroupPermissions", fmt.Sprintf("%s/rest/api/1.0/admin/permissions/groups", client.baseURL.String()), func(data []byte) (Page, error) {
+		var r GroupPermissions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return Page{}, err
+		}
+		permissions = append(permissions, r.GroupPermissions...)
+		return r.Page, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetProjectDefaultPermission returns the permission every licensed user holds on the project, PROJECT_WRITE or
+// PROJECT_READ, or an empty permission if there is none.
+func (client Client) GetProjectDefaultPermission(projectKey string) (Permission, error) {
+	for _, permission := range []Permission{PermissionProjectWrite, PermissionProjectRead} {
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+		var r struct {
+			Permitted bool `json:"permitted"`
+		}
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/all", client.permissionsURL(projectKey, "", string(permission))), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetProjectDefaultPermission %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			responseCode, data, err := consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Does the project exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+
+			return json.Unmarshal(data, &r)
+		}
+		if err := retry.Try(work); err != nil {
+			return "", err
+		}
+		if r.Permitted {
+			return permission, nil
+		}
+	}
+	return "", nil
+}
+
+// GrantUserPermission grants permission to each of the named users, replacing any permission they already hold on
+// the repository or project.  permission must be a REPO_* permission for a repository and a PROJECT_* permission
+// for a project.
+func (client Client) GrantUserPermission(projectKey, repositorySlug string, permission Permission, userNames ...string) error {
+	return client.grantPermission("GrantUserPermission", projectKey, repositorySlug, "users", permission, userNames)
+}
+
+// GrantGroupPermission grants permission to each of the named groups.
+func (client Client) GrantGroupPermission(projectKey, repositorySlug string, permission Permission, groups ...string) error {
+	return client.grantPermission("GrantGroupPermission", projectKey, repositorySlug, "groups", permission, groups)
+}
+
+// RevokeUserPermissions revokes every permission the user holds on the repository or project.
+func (client Client) RevokeUserPermissions(projectKey, repositorySlug, userName string) error {
+	return client.revokePermissions("RevokeUserPermissions", projectKey, repositorySlug, "users", userName)
+}
+
+// RevokeGroupPermissions revokes every permission the group holds on the repository or project.
+func (client Client) RevokeGroupPermissions(projectKey, repositorySlug, group string) error {
+	return client.revokePermissions("RevokeGroupPermissions", projectKey, repositorySlug, "groups", group)
+}
+
+func (client Client) grantPermission(operation, projectKey, repositorySlug, kind string, permission Permission, names []string) error {
+	if err := checkPermissionScope(repositorySlug, permission); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("permission", string(permission))
+	for _, name := range names {
+		params.Add("name", name)
+	}
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s?%s", client.permissionsURL(projectKey, repositorySlug, kind), params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return err
+	}
+	if responseCode != http.StatusNoContent && responseCode != http.StatusOK {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The permission was not granted due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage permissions."
+		case responseCode == http.StatusForbidden:
+			reason = "The permission change would revoke the currently authenticated user's own admin access."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  The users or groups?"
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+	return nil
+}
+
+func (client Client) revokePermissions(operation, projectKey, repositorySlug, kind, name string) error {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		params := url.Values{}
+		params.Set("name", name)
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s?%s", client.permissionsURL(projectKey, repositorySlug, kind), params.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent && responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			case responseCode == http.StatusConflict:
+				reason = "Conflict.  Revoking the permission would remove the last admin."
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+// getPermissionPages reads every page of a permission listing, passing each page body to read.
+func (client Client) getPermissionPages(operation, permissionsURL string, read func(data []byte) (Page, error)) error {
+	start := 0
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s?start=%d&limit=%d", permissionsURL, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.%s %s\n", operation, req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return err
+		}
+
+		page, err := read(data)
+		if err != nil {
+			return err
+		}
+		morePages = !page.IsLastPage
+		start = page.NextPageStart
+	}
+	return nil
+}
+
+// checkPermissionScope checks that permission is a project permission if repositorySlug is empty and a repository
+// permission otherwise.
+func checkPermissionScope(repositorySlug string, permission Permission) error {
+	if repositorySlug == "" && !permission.IsProject() {
+		return fmt.Errorf("stash: %s is not a project permission", permission)
+	}
+	if repositorySlug != "" && !permission.IsRepository() {
+		return fmt.Errorf("stash: %s is not a repository permission", permission)
+	}
+	return nil
+}
+
+func (client Client) permissionsURL(projectKey, repositorySlug, kind string) string {
+	if repositorySlug == "" {
+		return fmt.Sprintf("%s/rest/api/1.0/projects/%s/permissions/%s", client.baseURL.String(), projectKey, kind)
+	}
+	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/permissions/%s", client.baseURL.String(), projectKey, repositorySlug, kind)
+}
@@ -0,0 +1,223 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGetUserPermissions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/permissions/users" {
+			t.Fatalf("GetUserPermissions() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/permissions/users but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		if url.Query().Get("start") == "0" {
+			fmt.Fprint(w, `{"isLastPage": false, "nextPageStart": 1, "values": [{"user": {"name": "alice", "slug": "alice"}, "permission": "REPO_ADMIN"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"user": {"name": "bob", "slug": "bob"}, "permission": "REPO_WRITE"}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	permissions, err := stashClient.GetUserPermissions("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(permissions) != 2 {
+		t.Fatalf("Want 2 permissions but got %d\n", len(permissions))
+	}
+	if permissions[0].User.Name != "alice" || permissions[0].Permission != PermissionRepoAdmin {
+		t.Fatalf("Want alice REPO_ADMIN but got %+v\n", permissions[0])
+	}
+	if permissions[1].User.Name != "bob" || permissions[1].Permission != PermissionRepoWrite {
+		t.Fatalf("Want bob REPO_WRITE but got %+v\n", permissions[1])
+	}
+}
+
+func TestGetGroupPermissionsForProject(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/permissions/groups" {
+			t.Fatalf("GetGroupPermissions() URL path expected to be /rest/api/1.0/projects/PROJ/permissions/groups but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"group": {"name": "developers"}, "permission": "PROJECT_WRITE"}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	permissions, err := stashClient.GetGroupPermissions("PROJ", "")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(permissions) != 1 || permissions[0].Group.Name != "developers" || permissions[0].Permission != PermissionProjectWrite {
+		t.Fatalf("Want developers PROJECT_WRITE but got %+v\n", permissions)
+	}
+}
+
+func TestGetGlobalPermissions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/admin/permissions/users":
+			fmt.Fprint(w, `{"isLastPage": true, "values": [{"user": {"name": "admin"}, "permission": "SYS_ADMIN"}]}`)
+		case "/rest/api/1.0/admin/permissions/groups":
+			fmt.Fprint(w, `{"isLastPage": true, "values": [{"group": {"name": "stash-users"}, "permission": "LICENSED_USER"}]}`)
+		default:
+			t.Fatalf("Unexpected path %s\n", r.URL.Path)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	users, err := stashClient.GetGlobalUserPermissions()
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(users) != 1 || users[0].Permission != PermissionSysAdmin || !users[0].Permission.IsGlobal() {
+		t.Fatalf("Want admin SYS_ADMIN but got %+v\n", users)
+	}
+	groups, err := stashClient.GetGlobalGroupPermissions()
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(groups) != 1 || groups[0].Permission != PermissionLicensedUser {
+		t.Fatalf("Want stash-users LICENSED_USER but got %+v\n", groups)
+	}
+}
+
+func TestGetProjectDefaultPermission(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/PROJ/permissions/PROJECT_WRITE/all":
+			fmt.Fprint(w, `{"permitted": false}`)
+		case "/rest/api/1.0/projects/PROJ/permissions/PROJECT_READ/all":
+			fmt.Fprint(w, `{"permitted": true}`)
+		default:
+			t.Fatalf("Unexpected path %s\n", r.URL.Path)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	permission, err := stashClient.GetProjectDefaultPermission("PROJ")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if permission != PermissionProjectRead {
+		t.Fatalf("Want PROJECT_READ but got %s\n", permission)
+	}
+}
+
+func TestGrantUserPermission(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/permissions/users" {
+			t.Fatalf("GrantUserPermission() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/permissions/users but found %s\n", url.Path)
+		}
+		params := url.Query()
+		if params.Get("permission") != "REPO_WRITE" {
+			t.Fatalf("Want permission REPO_WRITE but got %s\n", url.RawQuery)
+		}
+		if names := params["name"]; len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+			t.Fatalf("Want names alice and bob but got %v\n", names)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.GrantUserPermission("PROJ", "slug", PermissionRepoWrite, "alice", "bob"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestGrantPermissionScope(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request for a permission of the wrong scope\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.GrantGroupPermission("PROJ", "", PermissionRepoWrite, "developers"); err == nil {
+		t.Fatalf("Want an error granting a repository permission on a project\n")
+	}
+	if err := stashClient.GrantGroupPermission("PROJ", "slug", PermissionProjectRead, "developers"); err == nil {
+		t.Fatalf("Want an error granting a project permission on a repository\n")
+	}
+	if err := stashClient.GrantUserPermission("PROJ", "slug", PermissionAdmin, "alice"); err == nil {
+		t.Fatalf("Want an error granting a global permission on a repository\n")
+	}
+	if err := stashClient.GrantUserPermission("PROJ", "", PermissionProjectView, "alice"); err == nil {
+		t.Fatalf("Want an error granting PROJECT_VIEW\n")
+	}
+}
+
+func TestGrantGroupPermission403(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.GrantGroupPermission("PROJ", "", PermissionProjectRead, "developers"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestRevokeGroupPermissions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/permissions/groups" {
+			t.Fatalf("RevokeGroupPermissions() URL path expected to be /rest/api/1.0/projects/PROJ/permissions/groups but found %s\n", url.Path)
+		}
+		if url.Query().Get("name") != "contractors" {
+			t.Fatalf("Want name contractors but got %s\n", url.RawQuery)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.RevokeGroupPermissions("PROJ", "", "contractors"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestPermissionScopes(t *testing.T) {
+	var tests = []struct {
+		permission                      Permission
+		global, project, repositoryWide bool
+	}{
+		{PermissionLicensedUser, true, false, false},
+		{PermissionProjectCreate, true, false, false},
+		{PermissionProjectView, false, false, false},
+		{PermissionProjectRead, false, true, false},
+		{PermissionProjectAdmin, false, true, false},
+		{PermissionRepoWrite, false, false, true},
+	}
+	for _, test := range tests {
+		if test.permission.IsGlobal() != test.global || test.permission.IsProject() != test.project || test.permission.IsRepository() != test.repositoryWide {
+			t.Fatalf("Unexpected scope for %s\n", test.permission)
+		}
+	}
+}
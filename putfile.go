@@ -0,0 +1,134 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type (
+	// StaleCommitError is returned by PutFile when the branch has moved past the source commit the edit was
+	// based on.  Re-read the file, reapply the change and try again with the new commit.
+	StaleCommitError struct {
+		Path           string
+		Branch         string
+		SourceCommitID string
+		Message        string
+	}
+
+	errorMessages struct {
+		Errors []struct {
+			Message       string `json:"message"`
+			ExceptionName string `json:"exceptionName"`
+		} `json:"errors"`
+	}
+)
+
+func (e StaleCommitError) Error() string {
+	return fmt.Sprintf("%s on %s has changed since %s: %s", e.Path, e.Branch, e.SourceCommitID, e.Message)
+}
+
+// IsStaleCommit reports whether err is a StaleCommitError.
+func IsStaleCommit(err error) bool {
+	_, ok := err.(StaleCommitError)
+	return ok
+}
+
+// PutFile commits content to filePath on branch and returns the new commit.  sourceCommitID is the commit the
+// edit is based on, normally the commit the file was read at; it must be empty when creating a new file.  If the
+// branch has moved past sourceCommitID the edit is refused with a StaleCommitError.
+func (client Client) PutFile(projectKey, repositorySlug, filePath, branch string, content []byte, message, sourceCommitID string) (Commit, error) {
+	fields := map[string]string{
+		"branch":  branch,
+		"message": message,
+	}
+	if sourceCommitID != "" {
+		fields["sourceCommitId"] = sourceCommitID
+	}
+	return client.putFile(projectKey, repositorySlug, filePath, content, fields)
+}
+
+// PutFileOnNewBranch creates branch from sourceBranch and commits content to filePath on it in one step, as
+// an edit made for a pull request would.
+func (client Client) PutFileOnNewBranch(projectKey, repositorySlug, filePath, branch, sourceBranch string, content []byte, message string) (Commit, error) {
+	return client.putFile(projectKey, repositorySlug, filePath, content, map[string]string{
+		"branch":       branch,
+		"sourceBranch": sourceBranch,
+		"message":      message,
+	})
+}
+
+func (client Client) putFile(projectKey, repositorySlug, filePath string, content []byte, fields map[string]string) (Commit, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return Commit{}, err
+		}
+	}
+	part, err := form.CreateFormFile("content", path.Base(filePath))
+	if err != nil {
+		return Commit{}, err
+	}
+	if _, err := part.Write(content); err != nil {
+		return Commit{}, err
+	}
+	if err := form.Close(); err != nil {
+		return Commit{}, err
+	}
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/browse%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath)), &body)
+	if err != nil {
+		return Commit{}, err
+	}
+	Log.Printf("stash.PutFile %s\n", req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", form.FormDataContentType())
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return Commit{}, err
+	}
+	if responseCode != http.StatusOK {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The file was not committed due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to commit to the branch."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  The branch?"
+		case responseCode == http.StatusConflict:
+			return Commit{}, StaleCommitError{Path: filePath, Branch: fields["branch"], SourceCommitID: fields["sourceCommitId"], Message: serverMessage(data)}
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return Commit{}, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+
+	var t Commit
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Commit{}, err
+	}
+	return t, nil
+}
+
+// serverMessage returns the messages of a Stash error response body, or the empty string if there are none.
+func serverMessage(data []byte) string {
+	var e errorMessages
+	if err := json.Unmarshal(data, &e); err != nil {
+		return ""
+	}
+	messages := make([]string, 0, len(e.Errors))
+	for _, m := range e.Errors {
+		messages = append(messages, m.Message)
+	}
+	return strings.Join(messages, "  ")
+}
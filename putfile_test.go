@@ -0,0 +1,116 @@
+package stash
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPutFile(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/browse/config/app.yaml" {
+			t.Fatalf("PutFile() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/browse/config/app.yaml but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Atlassian-Token") != "no-check" {
+			t.Fatalf("Want X-Atlassian-Token no-check but found %s\n", r.Header.Get("X-Atlassian-Token"))
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		for k, v := range map[string]string{"branch": "master", "message": "Bump version", "sourceCommitId": "abcdef0"} {
+			if r.FormValue(k) != v {
+				t.Fatalf("Want %s=%s but found %s\n", k, v, r.FormValue(k))
+			}
+		}
+		if _, ok := r.MultipartForm.Value["sourceBranch"]; ok {
+			t.Fatalf("Want no sourceBranch but found one\n")
+		}
+		file, _, err := r.FormFile("content")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		content, _ := ioutil.ReadAll(file)
+		if string(content) != "version: 2\n" {
+			t.Fatalf("Want version: 2 but found %s\n", string(content))
+		}
+		fmt.Fprint(w, commitResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	commit, err := stashClient.PutFile("PROJ", "slug", "config/app.yaml", "master", []byte("version: 2\n"), "Bump version", "abcdef0")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if commit.DisplayID != "def0123abcd" {
+		t.Fatalf("Want def0123abcd but got %s\n", commit.DisplayID)
+	}
+}
+
+func TestPutFileOnNewBranch(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		for k, v := range map[string]string{"branch": "bump/2", "sourceBranch": "master", "message": "Bump version"} {
+			if r.FormValue(k) != v {
+				t.Fatalf("Want %s=%s but found %s\n", k, v, r.FormValue(k))
+			}
+		}
+		if _, ok := r.MultipartForm.Value["sourceCommitId"]; ok {
+			t.Fatalf("Want no sourceCommitId but found one\n")
+		}
+		fmt.Fprint(w, commitResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.PutFileOnNewBranch("PROJ", "slug", "config/app.yaml", "bump/2", "master", []byte("version: 2\n"), "Bump version"); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestPutFileStaleCommit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(409)
+		fmt.Fprint(w, `{"errors": [{"context": null, "message": "The file has been modified since abcdef0.", "exceptionName": null}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	_, err := stashClient.PutFile("PROJ", "slug", "config/app.yaml", "master", []byte("version: 2\n"), "Bump version", "abcdef0")
+	if !IsStaleCommit(err) {
+		t.Fatalf("Want a stale commit error but got %v\n", err)
+	}
+	stale := err.(StaleCommitError)
+	if stale.SourceCommitID != "abcdef0" || stale.Message != "The file has been modified since abcdef0." {
+		t.Fatalf("Want abcdef0 and the server message but got %+v\n", stale)
+	}
+}
+
+func TestPutFile401(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	_, err := stashClient.PutFile("PROJ", "slug", "config/app.yaml", "master", []byte("version: 2\n"), "Bump version", "abcdef0")
+	if err == nil || IsStaleCommit(err) {
+		t.Fatalf("Want an unauthorized error but got %v\n", err)
+	}
+}
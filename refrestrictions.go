@@ -0,0 +1,296 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// Branch permissions 2.0 (ref restrictions).  Every method takes a project key and a repository slug; an empty
+// repository slug addresses the restrictions of the project itself, which apply to all of its repositories.
+
+type (
+	RefRestrictionType string
+	RefMatcherType     string
+
+	RefRestrictions struct {
+		Page
+		RefRestrictions []RefRestriction `json:"values"`
+	}
+
+	RefRestriction struct {
+		ID         int                 `json:"id"`
+		Scope      RefRestrictionScope `json:"scope"`
+		Type       RefRestrictionType  `json:"type"`
+		Matcher    RefMatcher          `json:"matcher"`
+		Users      []User              `json:"users"`
+		Groups     []string            `json:"groups"`
+		AccessKeys []AccessKey         `json:"accessKeys"`
+	}
+
+	RefRestrictionScope struct {
+		Type       string `json:"type"`
+		ResourceID int    `json:"resourceId"`
+	}
+
+	RefMatcher struct {
+		ID        string         `json:"id"`
+		DisplayID string         `json:"displayId"`
+		Type      RefMatcherKind `json:"type"`
+		Active    bool           `json:"active"`
+	}
+
+	RefMatcherKind struct {
+		ID   RefMatcherType `json:"id"`
+		Name string         `json:"name,omitempty"`
+	}
+
+	// RefRestrictionRequest describes a restriction to create or update.  Users, Groups and AccessKeyIDs are
+	// exempt from the restriction.
+	RefRestrictionRequest struct {
+		Type         RefRestrictionType `json:"type"`
+		Matcher      RefMatcher         `json:"matcher"`
+		Users        []string           `json:"users"`
+		Groups       []string           `json:"groups"`
+		AccessKeyIDs []int              `json:"accessKeyIds"`
+	}
+)
+
+const (
+	RestrictionReadOnly        RefRestrictionType = "read-only"
+	RestrictionNoDeletes       RefRestrictionType = "no-deletes"
+	RestrictionFastForwardOnly RefRestrictionType = "fast-forward-only"
+	RestrictionPullRequestOnly RefRestrictionType = "pull-request-only"
+)
+
+const (
+	MatcherBranch        RefMatcherType = "BRANCH"
+	MatcherPattern       RefMatcherType = "PATTERN"
+	MatcherModelCategory RefMatcherType = "MODEL_CATEGORY"
+	MatcherModelBranch   RefMatcherType = "MODEL_BRANCH"
+)
+
+// BranchMatcher matches a single branch.
+func BranchMatcher(branchName string) RefMatcher {
+	ref := qualifiedBranchRef(branchName)
+	return RefMatcher{ID: ref, DisplayID: strings.TrimPrefix(ref, "refs/heads/"), Type: RefMatcherKind{ID: MatcherBranch, Name: "Branch"}, Active: true}
+}
+
+// PatternMatcher matches branches and tags by wildcard pattern, e.g. "release/*".
+func PatternMatcher(pattern string) RefMatcher {
+	return RefMatcher{ID: pattern, DisplayID: pattern, Type: RefMatcherKind{ID: MatcherPattern, Name: "Pattern"}, Active: true}
+}
+
+// ModelCategoryMatcher matches the branches of a branching model category: FEATURE, BUGFIX, HOTFIX or RELEASE.
+func ModelCategoryMatcher(category string) RefMatcher {
+	return RefMatcher{ID: category, DisplayID: category, Type: RefMatcherKind{ID: MatcherModelCategory, Name: "Branching model category"}, Active: true}
+}
+
+// ModelBranchMatcher matches a branching model branch: development or production.
+func ModelBranchMatcher(modelBranch string) RefMatcher {
+	return RefMatcher{ID: modelBranch, DisplayID: modelBranch, Type: RefMatcherKind{ID: MatcherModelBranch, Name: "Branching model branch"}, Active: true}
+}
+
+// CreateRefRestriction creates a branch permission using the branch permissions 2.0 API.
+func (client Client) CreateRefRestriction(projectKey, repositorySlug string, restriction RefRestrictionRequest) (RefRestriction, error) {
+	return client.sendRefRestriction("CreateRefRestriction", "POST", client.refRestrictionsURL(projectKey, repositorySlug), restriction)
+}
+
+// UpdateRefRestriction replaces the restriction with the given id.  The 2.0 API has no update as such: posting a
+// restriction replaces the one with the same type and matcher, keeping its id.  If the type or matcher changes, the
+// new restriction is saved under a new id and the old one is then deleted; should that delete fail, the new
+// restriction is returned with the error.
+func (client Client) UpdateRefRestriction(projectKey, repositorySlug string, id int, restriction RefRestrictionRequest) (RefRestriction, error) {
+	saved, err := client.sendRefRestriction("UpdateRefRestriction", "POST", client.refRestrictionsURL(projectKey, repositorySlug), restriction)
+	if err != nil {
+		return RefRestriction{}, err
+	}
+	if saved.ID != id {
+		if err := client.DeleteRefRestriction(projectKey, repositorySlug, id); err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+func (client Client) sendRefRestriction(operation, method, restrictionURL string, restriction RefRestrictionRequest) (RefRestriction, error) {
+	if restriction.Users == nil {
+		restriction.Users = []string{}
+	}
+	if restriction.Groups == nil {
+		restriction.Groups = []string{}
+	}
+	if restriction.AccessKeyIDs == nil {
+		restriction.AccessKeyIDs = []int{}
+	}
+
+	data, err := json.Marshal(restriction)
+	if err != nil {
+		return RefRestriction{}, err
+	}
+
+	req, err := http.NewRequest(method, restrictionURL, bytes.NewReader(data))
+	if err != nil {
+		return RefRestriction{}, err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return RefRestriction{}, err
+	}
+	if responseCode != http.StatusOK && responseCode != http.StatusCreated {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The ref restriction was not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage ref restrictions."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  The restriction?"
+		}
+		return RefRestriction{}, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+
+	var t RefRestriction
+	if err := json.Unmarshal(data, &t); err != nil {
+		return RefRestriction{}, err
+	}
+	return t, nil
+}
+
+// GetRefRestriction returns the restriction with the given id.
+func (client Client) GetRefRestriction(projectKey, repositorySlug string, id int) (RefRestriction, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var restriction RefRestriction
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%d", client.refRestrictionsURL(projectKey, repositorySlug), id), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetRefRestriction %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &restriction)
+	}
+
+	return restriction, retry.Try(work)
+}
+
+// GetRefRestrictions returns all restrictions of the repository, or of the project if repositorySlug is empty.
+func (client Client) GetRefRestrictions(projectKey, repositorySlug string) ([]RefRestriction, error) {
+	start := 0
+	restrictions := make([]RefRestriction, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s?start=%d&limit=%d", client.refRestrictionsURL(projectKey, repositorySlug), start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetRefRestrictions %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r RefRestrictions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r.RefRestrictions...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return restrictions, nil
+}
+
+// DeleteRefRestriction deletes the restriction with the given id.
+func (client Client) DeleteRefRestriction(projectKey, repositorySlug string, id int) error {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%d", client.refRestrictionsURL(projectKey, repositorySlug), id), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.DeleteRefRestriction %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+func (client Client) refRestrictionsURL(projectKey, repositorySlug string) string {
+	if repositorySlug == "" {
+		return fmt.Sprintf("%s/rest/branch-permissions/2.0/projects/%s/restrictions", client.baseURL.String(), projectKey)
+	}
+	return fmt.Sprintf("%s/rest/branch-permissions/2.0/projects/%s/repos/%s/restrictions", client.baseURL.String(), projectKey, repositorySlug)
+}
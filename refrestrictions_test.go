@@ -0,0 +1,294 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const refRestrictionResponse string = `
+{
+	"id": 7,
+	"scope": {
+		"type": "REPOSITORY",
+		"resourceId": 536
+	},
+	"type": "fast-forward-only",
+	"matcher": {
+		"id": "release/*",
+		"displayId": "release/*",
+		"type": {
+			"id": "PATTERN",
+			"name": "Pattern"
+		},
+		"active": true
+	},
+	"users": [
+		{
+			"name": "charlie"
+		}
+	],
+	"groups": [
+		"release-managers"
+	],
+	"accessKeys": [
+		{
+			"key": {
+				"id": 3,
+				"label": "ci"
+			}
+		}
+	]
+}
+`
+
+const refRestrictionsResponse string = `
+{
+	"isLastPage": true,
+	"size": 1,
+	"start": 0,
+	"values": [
+` + refRestrictionResponse + `
+	]
+}
+`
+
+func TestCreateRefRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions" {
+			t.Fatalf("CreateRefRestriction() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions but found %s\n", url.Path)
+		}
+		if r.Header.Get("Content-type") != "application/json" {
+			t.Fatalf("Want Content-type application/json but found %s\n", r.Header.Get("Content-type"))
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var request RefRestrictionRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if request.Type != RestrictionFastForwardOnly {
+			t.Fatalf("Want fast-forward-only but got %s\n", request.Type)
+		}
+		if request.Matcher.Type.ID != MatcherPattern || request.Matcher.ID != "release/*" {
+			t.Fatalf("Want PATTERN release/* but got %+v\n", request.Matcher)
+		}
+		if len(request.Users) != 1 || len(request.Groups) != 1 || len(request.AccessKeyIDs) != 1 {
+			t.Fatalf("Want one user, group and access key but got %+v\n", request)
+		}
+		fmt.Fprint(w, refRestrictionResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	request := RefRestrictionRequest{
+		Type:         RestrictionFastForwardOnly,
+		Matcher:      PatternMatcher("release/*"),
+		Users:        []string{"charlie"},
+		Groups:       []string{"release-managers"},
+		AccessKeyIDs: []int{3},
+	}
+	restriction, err := stashClient.CreateRefRestriction("PROJ", "slug", request)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+
+	// spot checks
+	if restriction.ID != 7 {
+		t.Fatalf("Want 7 but got %d\n", restriction.ID)
+	}
+	if restriction.Scope.Type != "REPOSITORY" {
+		t.Fatalf("Want REPOSITORY but got %s\n", restriction.Scope.Type)
+	}
+	if restriction.Users[0].Name != "charlie" {
+		t.Fatalf("Want charlie but got %s\n", restriction.Users[0].Name)
+	}
+	if restriction.AccessKeys[0].Key.ID != 3 {
+		t.Fatalf("Want access key 3 but got %d\n", restriction.AccessKeys[0].Key.ID)
+	}
+}
+
+func TestCreateProjectRefRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/restrictions" {
+			t.Fatalf("CreateRefRestriction() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/restrictions but found %s\n", url.Path)
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		var request map[string]interface{}
+		if err := json.Unmarshal(data, &request); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		for _, k := range []string{"users", "groups", "accessKeyIds"} {
+			if _, ok := request[k].([]interface{}); !ok {
+				t.Fatalf("Want %s to be an empty list but got %v\n", k, request[k])
+			}
+		}
+		fmt.Fprint(w, refRestrictionResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.CreateRefRestriction("PROJ", "", RefRestrictionRequest{Type: RestrictionNoDeletes, Matcher: ModelBranchMatcher("production")}); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestCreateRefRestriction400(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.CreateRefRestriction("PROJ", "slug", RefRestrictionRequest{Type: "bogus", Matcher: BranchMatcher("master")}); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestUpdateRefRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions" {
+			t.Fatalf("UpdateRefRestriction() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, refRestrictionResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	restriction, err := stashClient.UpdateRefRestriction("PROJ", "slug", 7, RefRestrictionRequest{Type: RestrictionReadOnly, Matcher: PatternMatcher("release/*"), Users: []string{"bob"}})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if restriction.ID != 7 {
+		t.Fatalf("Want restriction 7 but got %d\n", restriction.ID)
+	}
+}
+
+func TestUpdateRefRestrictionNewMatcher(t *testing.T) {
+	var requests []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions":
+			fmt.Fprint(w, strings.Replace(refRestrictionResponse, `"id": 7`, `"id": 8`, 1))
+		case "DELETE /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7":
+			w.WriteHeader(204)
+		default:
+			t.Fatalf("Unexpected request %s %s\n", r.Method, r.URL.Path)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	restriction, err := stashClient.UpdateRefRestriction("PROJ", "slug", 7, RefRestrictionRequest{Type: RestrictionReadOnly, Matcher: BranchMatcher("master")})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if restriction.ID != 8 {
+		t.Fatalf("Want restriction 8 but got %d\n", restriction.ID)
+	}
+	if len(requests) != 2 || requests[1] != "DELETE /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7" {
+		t.Fatalf("Want the old restriction deleted after saving the new one but got %v\n", requests)
+	}
+}
+
+func TestGetRefRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7" {
+			t.Fatalf("GetRefRestriction() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7 but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, refRestrictionResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	restriction, err := stashClient.GetRefRestriction("PROJ", "slug", 7)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if restriction.Matcher.Type.ID != MatcherPattern {
+		t.Fatalf("Want PATTERN but got %s\n", restriction.Matcher.Type.ID)
+	}
+}
+
+func TestGetRefRestrictions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions" {
+			t.Fatalf("GetRefRestrictions() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, refRestrictionsResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	restrictions, err := stashClient.GetRefRestrictions("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(restrictions) != 1 {
+		t.Fatalf("Want 1 restriction but got %d\n", len(restrictions))
+	}
+}
+
+func TestDeleteRefRestriction(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7" {
+			t.Fatalf("DeleteRefRestriction() URL path expected to be /rest/branch-permissions/2.0/projects/PROJ/repos/slug/restrictions/7 but found %s\n", url.Path)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteRefRestriction("PROJ", "slug", 7); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestBranchMatcher(t *testing.T) {
+	for _, name := range []string{"master", "refs/heads/master"} {
+		matcher := BranchMatcher(name)
+		if matcher.ID != "refs/heads/master" || matcher.DisplayID != "master" || matcher.Type.ID != MatcherBranch {
+			t.Fatalf("Want refs/heads/master branch matcher but got %+v\n", matcher)
+		}
+	}
+}
@@ -227,6 +227,33 @@ func TestGetRepositories(t *testing.T) {
 
 }
 
+func TestGetProjectRepositories(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("wanted GET but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/TEAMP/repos" {
+			t.Fatalf("GetProjectRepositories() URL path expected to be /rest/api/1.0/projects/TEAMP/repos but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want  Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		fmt.Fprintln(w, repos)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	repositories, err := stashClient.GetProjectRepositories("TEAMP")
+	if err != nil {
+		t.Fatalf("GetProjectRepositories() not expecting an error, but received: %v\n", err)
+	}
+	if len(repositories) != 3 {
+		t.Fatalf("GetProjectRepositories() expected 3 repositories, but received %d\n", len(repositories))
+	}
+}
+
 func TestGetRepositories500(t *testing.T) {
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
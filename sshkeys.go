@@ -0,0 +1,393 @@
+package stash
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// User SSH keys and access keys.  Access key methods take a project key and a repository slug; an empty repository
+// slug addresses the access keys of the project, which can read or write all of its repositories.
+
+type (
+	SshKeys struct {
+		Page
+		SshKeys []SshKey `json:"values"`
+	}
+
+	SshKey struct {
+		ID    int    `json:"id,omitempty"`
+		Text  string `json:"text"`
+		Label string `json:"label,omitempty"`
+	}
+
+	AccessKeys struct {
+		Page
+		AccessKeys []AccessKey `json:"values"`
+	}
+
+	// AccessKey is an SSH key that grants read or write access to a repository or project without a user.
+	// Permission is REPO_READ or REPO_WRITE for a repository and PROJECT_READ or PROJECT_WRITE for a project.
+	AccessKey struct {
+		Key        SshKey     `json:"key"`
+		Permission Permission `json:"permission,omitempty"`
+	}
+)
+
+// GetUserSshKeys returns the SSH keys of the user with the given slug, or of the authenticated user if userSlug is
+// empty.
+func (client Client) GetUserSshKeys(userSlug string) ([]SshKey, error) {
+	start := 0
+	keys := make([]SshKey, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := url.Values{}
+			if userSlug != "" {
+				params.Set("user", userSlug)
+			}
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/ssh/1.0/keys?%s", client.baseURL.String(), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetUserSshKeys %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Does the user exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r SshKeys
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		keys = append(keys, r.SshKeys...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return keys, nil
+}
+
+// AddUserSshKey adds a public key, in authorized_keys format, to the user with the given slug, or to the
+// authenticated user if userSlug is empty.  An empty label keeps the comment of the key as its label.
+func (client Client) AddUserSshKey(userSlug, text, label string) (SshKey, error) {
+	params := url.Values{}
+	if userSlug != "" {
+		params.Set("user", userSlug)
+	}
+	key := SshKey{Text: strings.TrimSpace(text), Label: label}
+	data, err := client.sendKey("AddUserSshKey", "POST", fmt.Sprintf("%s/rest/ssh/1.0/keys?%s", client.baseURL.String(), params.Encode()), key)
+	if err != nil {
+		return SshKey{}, err
+	}
+	var t SshKey
+	if err := json.Unmarshal(data, &t); err != nil {
+		return SshKey{}, err
+	}
+	return t, nil
+}
+
+// DeleteUserSshKey deletes the user SSH key with the given id.
+func (client Client) DeleteUserSshKey(id int) error {
+	return client.deleteKey("DeleteUserSshKey", fmt.Sprintf("%s/rest/ssh/1.0/keys/%d", client.baseURL.String(), id))
+}
+
+// GetAccessKeys returns the access keys of the repository, or of the project if repositorySlug is empty.
+func (client Client) GetAccessKeys(projectKey, repositorySlug string) ([]AccessKey, error) {
+	start := 0
+	keys := make([]AccessKey, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s?start=%d&limit=%d", client.accessKeysURL(projectKey, repositorySlug), start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetAccessKeys %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r AccessKeys
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		keys = append(keys, r.AccessKeys...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return keys, nil
+}
+
+// GetAccessKey returns the access key with the given id.
+func (client Client) GetAccessKey(projectKey, repositorySlug string, id int) (AccessKey, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var key AccessKey
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%d", client.accessKeysURL(projectKey, repositorySlug), id), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetAccessKey %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &key)
+	}
+
+	return key, retry.Try(work)
+}
+
+// AddAccessKey adds a public key, in authorized_keys format, as an access key with the given permission.  A key
+// that is already an access key elsewhere is reused.
+func (client Client) AddAccessKey(projectKey, repositorySlug, text, label string, permission Permission) (AccessKey, error) {
+	if err := checkPermissionScope(repositorySlug, permission); err != nil {
+		return AccessKey{}, err
+	}
+	key := AccessKey{Key: SshKey{Text: strings.TrimSpace(text), Label: label}, Permission: permission}
+	data, err := client.sendKey("AddAccessKey", "POST", client.accessKeysURL(projectKey, repositorySlug), key)
+	if err != nil {
+		return AccessKey{}, err
+	}
+	var t AccessKey
+	if err := json.Unmarshal(data, &t); err != nil {
+		return AccessKey{}, err
+	}
+	return t, nil
+}
+
+// SetAccessKeyPermission changes the permission of the access key with the given id.
+func (client Client) SetAccessKeyPermission(projectKey, repositorySlug string, id int, permission Permission) (AccessKey, error) {
+	if err := checkPermissionScope(repositorySlug, permission); err != nil {
+		return AccessKey{}, err
+	}
+	data, err := client.sendKey("SetAccessKeyPermission", "PUT", fmt.Sprintf("%s/%d/permission/%s", client.accessKeysURL(projectKey, repositorySlug), id, permission), nil)
+	if err != nil {
+		return AccessKey{}, err
+	}
+	var t AccessKey
+	if err := json.Unmarshal(data, &t); err != nil {
+		return AccessKey{}, err
+	}
+	return t, nil
+}
+
+// DeleteAccessKey removes the access key with the given id from the repository or project.
+func (client Client) DeleteAccessKey(projectKey, repositorySlug string, id int) error {
+	return client.deleteKey("DeleteAccessKey", fmt.Sprintf("%s/%d", client.accessKeysURL(projectKey, repositorySlug), id))
+}
+
+// SshKeyFingerprint returns the SHA256 fingerprint of a public key in authorized_keys format, as printed by
+// ssh-keygen -l, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+func SshKeyFingerprint(text string) (string, error) {
+	blob, err := sshKeyBlob(text)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// SshKeyMD5Fingerprint returns the colon separated MD5 fingerprint of a public key, as shown by older versions of
+// Stash.
+func SshKeyMD5Fingerprint(text string) (string, error) {
+	blob, err := sshKeyBlob(text)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(blob)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hex, ":"), nil
+}
+
+// FindSshKey returns the key in keys that is the same public key as text, ignoring labels and comments.
+func FindSshKey(keys []SshKey, text string) (SshKey, bool) {
+	want, err := sshKeyBlob(text)
+	if err != nil {
+		return SshKey{}, false
+	}
+	for _, key := range keys {
+		if blob, err := sshKeyBlob(key.Text); err == nil && bytes.Equal(blob, want) {
+			return key, true
+		}
+	}
+	return SshKey{}, false
+}
+
+// sshKeyBlob returns the decoded key of an authorized_keys line.  Leading options are skipped by looking for the
+// first base64 field whose embedded key type matches the field before it.
+func sshKeyBlob(text string) ([]byte, error) {
+	fields := strings.Fields(text)
+	for i := 0; i+1 < len(fields); i++ {
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil || len(blob) < 4 {
+			continue
+		}
+		n := binary.BigEndian.Uint32(blob)
+		if uint64(n)+4 <= uint64(len(blob)) && string(blob[4:4+n]) == fields[i] {
+			return blob, nil
+		}
+	}
+	return nil, fmt.Errorf("stash: not an SSH public key")
+}
+
+func (client Client) sendKey(operation, method, keyURL string, key interface{}) ([]byte, error) {
+	var body []byte
+	if key != nil {
+		var err error
+		if body, err = json.Marshal(key); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, keyURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	if key != nil {
+		req.Header.Set("Content-type", "application/json")
+	}
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return nil, err
+	}
+	if responseCode != http.StatusOK && responseCode != http.StatusCreated {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The key was not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage the keys."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  The key?"
+		case responseCode == http.StatusConflict:
+			reason = "The key is already in use, e.g. by another user."
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return nil, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+	return data, nil
+}
+
+func (client Client) deleteKey(operation, keyURL string) error {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		req, err := http.NewRequest("DELETE", keyURL, nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent && responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+func (client Client) accessKeysURL(projectKey, repositorySlug string) string {
+	if repositorySlug == "" {
+		return fmt.Sprintf("%s/rest/keys/1.0/projects/%s/ssh", client.baseURL.String(), projectKey)
+	}
+	return fmt.Sprintf("%s/rest/keys/1.0/projects/%s/repos/%s/ssh", client.baseURL.String(), projectKey, repositorySlug)
+}
@@ -0,0 +1,245 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testPublicKey string = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIABkQVibIEEPSxV53qUqBxKFb78TnzSJLCR63xRdtnKf ci@build"
+
+func TestGetUserSshKeys(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/ssh/1.0/keys" {
+			t.Fatalf("GetUserSshKeys() URL path expected to be /rest/ssh/1.0/keys but found %s\n", url.Path)
+		}
+		if url.Query().Get("user") != "jcitizen" {
+			t.Fatalf("Want user jcitizen but got %s\n", url.RawQuery)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		fmt.Fprintf(w, `{"isLastPage": true, "values": [{"id": 1, "text": "%s", "label": "ci@build"}]}`, testPublicKey)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	keys, err := stashClient.GetUserSshKeys("jcitizen")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(keys) != 1 || keys[0].ID != 1 || keys[0].Label != "ci@build" {
+		t.Fatalf("Want key 1 but got %+v\n", keys)
+	}
+}
+
+func TestAddUserSshKey(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/ssh/1.0/keys" || r.URL.RawQuery != "" {
+			t.Fatalf("Want the authenticated user's keys but got %s\n", r.URL)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if string(data) != fmt.Sprintf(`{"text":"%s"}`, testPublicKey) {
+			t.Fatalf("Unexpected request body %s\n", data)
+		}
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"id": 2, "text": "%s", "label": "ci@build"}`, testPublicKey)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	key, err := stashClient.AddUserSshKey("", testPublicKey+"\n", "")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if key.ID != 2 {
+		t.Fatalf("Want key 2 but got %+v\n", key)
+	}
+}
+
+func TestAddUserSshKey409(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(409)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.AddUserSshKey("", testPublicKey, ""); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestDeleteUserSshKey(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/ssh/1.0/keys/2" {
+			t.Fatalf("DeleteUserSshKey() URL path expected to be /rest/ssh/1.0/keys/2 but found %s\n", r.URL.Path)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteUserSshKey(2); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestGetAccessKeys(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/keys/1.0/projects/PROJ/repos/slug/ssh" {
+			t.Fatalf("GetAccessKeys() URL path expected to be /rest/keys/1.0/projects/PROJ/repos/slug/ssh but found %s\n", url.Path)
+		}
+		fmt.Fprintf(w, `{"isLastPage": true, "values": [{"key": {"id": 3, "text": "%s", "label": "deploy"}, "permission": "REPO_READ"}]}`, testPublicKey)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	keys, err := stashClient.GetAccessKeys("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(keys) != 1 || keys[0].Key.ID != 3 || keys[0].Permission != PermissionRepoRead {
+		t.Fatalf("Want read-only key 3 but got %+v\n", keys)
+	}
+}
+
+func TestAddProjectAccessKey(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/keys/1.0/projects/PROJ/ssh" {
+			t.Fatalf("AddAccessKey() URL path expected to be /rest/keys/1.0/projects/PROJ/ssh but found %s\n", r.URL.Path)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		var key AccessKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if key.Permission != PermissionProjectWrite || key.Key.Label != "deploy" || key.Key.Text != testPublicKey {
+			t.Fatalf("Unexpected access key %+v\n", key)
+		}
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"key": {"id": 4, "text": "%s", "label": "deploy"}, "permission": "PROJECT_WRITE"}`, testPublicKey)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	key, err := stashClient.AddAccessKey("PROJ", "", testPublicKey, "deploy", PermissionProjectWrite)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if key.Key.ID != 4 {
+		t.Fatalf("Want key 4 but got %+v\n", key)
+	}
+	if _, err := stashClient.AddAccessKey("PROJ", "", testPublicKey, "deploy", PermissionRepoWrite); err == nil {
+		t.Fatalf("Want an error adding a project key with a repository permission\n")
+	}
+}
+
+func TestSetAccessKeyPermission(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/keys/1.0/projects/PROJ/repos/slug/ssh/3/permission/REPO_WRITE" {
+			t.Fatalf("SetAccessKeyPermission() URL path expected to be /rest/keys/1.0/projects/PROJ/repos/slug/ssh/3/permission/REPO_WRITE but found %s\n", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"key": {"id": 3, "text": "%s"}, "permission": "REPO_WRITE"}`, testPublicKey)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	key, err := stashClient.SetAccessKeyPermission("PROJ", "slug", 3, PermissionRepoWrite)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if key.Permission != PermissionRepoWrite {
+		t.Fatalf("Want REPO_WRITE but got %s\n", key.Permission)
+	}
+}
+
+func TestGetAndDeleteAccessKey(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/keys/1.0/projects/PROJ/repos/slug/ssh/3" {
+			t.Fatalf("URL path expected to be /rest/keys/1.0/projects/PROJ/repos/slug/ssh/3 but found %s\n", r.URL.Path)
+		}
+		switch r.Method {
+		case "GET":
+			fmt.Fprintf(w, `{"key": {"id": 3, "text": "%s"}, "permission": "REPO_READ"}`, testPublicKey)
+		case "DELETE":
+			w.WriteHeader(204)
+		default:
+			t.Fatalf("Unexpected method %s\n", r.Method)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	key, err := stashClient.GetAccessKey("PROJ", "slug", 3)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if key.Key.ID != 3 {
+		t.Fatalf("Want key 3 but got %+v\n", key)
+	}
+	if err := stashClient.DeleteAccessKey("PROJ", "slug", 3); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestSshKeyFingerprint(t *testing.T) {
+	fingerprint, err := SshKeyFingerprint(testPublicKey)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if fingerprint != "SHA256:zuwAWzxSq7rAecLhlSSKvKagKPu+KiUQekkj7XgXCEo" {
+		t.Fatalf("Unexpected fingerprint %s\n", fingerprint)
+	}
+
+	md5, err := SshKeyMD5Fingerprint(`no-pty,command="true" ` + testPublicKey)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if md5 != "fb:0b:d1:39:77:a2:8f:24:67:c4:5e:3e:23:61:6a:ff" {
+		t.Fatalf("Unexpected MD5 fingerprint %s\n", md5)
+	}
+
+	if _, err := SshKeyFingerprint("not a key"); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
+
+func TestFindSshKey(t *testing.T) {
+	keys := []SshKey{
+		{ID: 1, Text: "ssh-rsa AAAA"},
+		{ID: 2, Text: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIABkQVibIEEPSxV53qUqBxKFb78TnzSJLCR63xRdtnKf"},
+	}
+	key, ok := FindSshKey(keys, testPublicKey)
+	if !ok || key.ID != 2 {
+		t.Fatalf("Want key 2 but got %+v\n", key)
+	}
+	if _, ok := FindSshKey(keys[:1], testPublicKey); ok {
+		t.Fatalf("Want no match\n")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -25,16 +26,93 @@ type (
 	Stash interface {
 		CreateRepository(projectKey, slug string) (Repository, error)
 		GetRepositories() (map[int]Repository, error)
+		GetProjectRepositories(projectKey string) ([]Repository, error)
 		GetBranches(projectKey, repositorySlug string) (map[string]Branch, error)
+		ListBranches(projectKey, repositorySlug string, options BranchListOptions) ([]Branch, error)
+		GetDefaultBranch(projectKey, repositorySlug string) (Branch, error)
+		SetDefaultBranch(projectKey, repositorySlug, branchName string) error
 		GetTags(projectKey, repositorySlug string) (map[string]Tag, error)
 		CreateBranchRestriction(projectKey, repositorySlug, branch, user string) (BranchRestriction, error)
+		CreateBranchPermission(projectKey, repositorySlug string, permission BranchPermission) (BranchRestriction, error)
+		UpdateBranchRestriction(projectKey, repositorySlug string, id int, permission BranchPermission) (BranchRestriction, error)
 		GetBranchRestrictions(projectKey, repositorySlug string) (BranchRestrictions, error)
 		DeleteBranchRestriction(projectKey, repositorySlug string, id int) error
+		CreateRefRestriction(projectKey, repositorySlug string, restriction RefRestrictionRequest) (RefRestriction, error)
+		UpdateRefRestriction(projectKey, repositorySlug string, id int, restriction RefRestrictionRequest) (RefRestriction, error)
+		GetRefRestriction(projectKey, repositorySlug string, id int) (RefRestriction, error)
+		GetRefRestrictions(projectKey, repositorySlug string) ([]RefRestriction, error)
+		DeleteRefRestriction(projectKey, repositorySlug string, id int) error
 		GetRepository(projectKey, repositorySlug string) (Repository, error)
 		GetPullRequests(projectKey, repositorySlug, state string) ([]PullRequest, error)
-		GetRawFile(projectKey, repositorySlug, branch, filePath string) ([]byte, error)
+		GetRawFile(projectKey, repositorySlug, filePath, at string) ([]byte, error)
+		OpenRawFile(projectKey, repositorySlug, filePath, at string) (RawFile, error)
+		PutFile(projectKey, repositorySlug, filePath, branch string, content []byte, message, sourceCommitID string) (Commit, error)
+		PutFileOnNewBranch(projectKey, repositorySlug, filePath, branch, sourceBranch string, content []byte, message string) (Commit, error)
+		GetBlame(projectKey, repositorySlug, filePath, at string) ([]BlameRange, error)
+		GetPathHistory(projectKey, repositorySlug, filePath, at string) ([]Commit, error)
+		GetArchive(projectKey, repositorySlug, at string, format ArchiveFormat, paths []string, prefix string, w io.Writer) error
+		SetBuildStatus(commitID, key string, state BuildState, name, url, description string) error
+		GetBuildStatuses(commitID string) ([]BuildStatus, error)
+		GetBuildStats(commitIDs ...string) (map[string]BuildStats, error)
+		SetInsightReport(projectKey, repositorySlug, commitID, key string, report InsightReport) (InsightReport, error)
+		GetInsightReport(projectKey, repositorySlug, commitID, key string) (InsightReport, error)
+		GetInsightReports(projectKey, repositorySlug, commitID string) ([]InsightReport, error)
+		DeleteInsightReport(projectKey, repositorySlug, commitID, key string) error
+		AddInsightAnnotations(projectKey, repositorySlug, commitID, key string, annotations []InsightAnnotation) error
+		GetInsightAnnotations(projectKey, repositorySlug, commitID, key string) ([]InsightAnnotation, error)
+		DeleteInsightAnnotations(projectKey, repositorySlug, commitID, key string) error
+		GetUsers(options UserListOptions) ([]User, error)
+		GetUser(userSlug string) (User, error)
+		GetGroups(filter string) ([]string, error)
+		GetGroupMembers(group string) ([]User, error)
+		GetUserPermissions(projectKey, repositorySlug string) ([]UserPermission, error)
+		GetGroupPermissions(projectKey, repositorySlug string) ([]GroupPermission, error)
+		GetGlobalUserPermissions() ([]UserPermission, error)
+		GetGlobalGroupPermissions() ([]GroupPermission, error)
+		GetProjectDefaultPermission(projectKey string) (Permission, error)
+		GrantUserPermission(projectKey, repositorySlug string, permission Permission, userNames ...string) error
+		GrantGroupPermission(projectKey, repositorySlug string, permission Permission, groups ...string) error
+		RevokeUserPermissions(projectKey, repositorySlug, userName string) error
+		RevokeGroupPermissions(projectKey, repositorySlug, group string) error
+		GetUserSshKeys(userSlug string) ([]SshKey, error)
+		AddUserSshKey(userSlug, text, label string) (SshKey, error)
+		DeleteUserSshKey(id int) error
+		GetAccessKeys(projectKey, repositorySlug string) ([]AccessKey, error)
+		GetAccessKey(projectKey, repositorySlug string, id int) (AccessKey, error)
+		AddAccessKey(projectKey, repositorySlug, text, label string, permission Permission) (AccessKey, error)
+		SetAccessKeyPermission(projectKey, repositorySlug string, id int, permission Permission) (AccessKey, error)
+		DeleteAccessKey(projectKey, repositorySlug string, id int) error
+		CreateAccessToken(owner TokenOwner, token AccessTokenRequest) (NewAccessToken, error)
+		UpdateAccessToken(owner TokenOwner, tokenID string, token AccessTokenRequest) (AccessToken, error)
+		GetAccessTokens(owner TokenOwner) ([]AccessToken, error)
+		GetAccessToken(owner TokenOwner, tokenID string) (AccessToken, error)
+		RevokeAccessToken(owner TokenOwner, tokenID string) error
+		CreateWebhook(projectKey, repositorySlug string, webhook Webhook) (Webhook, error)
+		UpdateWebhook(projectKey, repositorySlug string, id int, webhook Webhook) (Webhook, error)
+		GetWebhook(projectKey, repositorySlug string, id int) (Webhook, error)
+		GetWebhooks(projectKey, repositorySlug string) ([]Webhook, error)
+		GetLatestWebhookInvocation(projectKey, repositorySlug string, id int) (WebhookInvocation, error)
+		TestWebhook(projectKey, repositorySlug, webhookURL string) (WebhookTestResult, error)
+		DeleteWebhook(projectKey, repositorySlug string, id int) error
+		GetHooks(projectKey, repositorySlug string, hookType HookType) ([]Hook, error)
+		GetHook(projectKey, repositorySlug, hookKey string) (Hook, error)
+		EnableHook(projectKey, repositorySlug, hookKey string) (Hook, error)
+		DisableHook(projectKey, repositorySlug, hookKey string) (Hook, error)
+		GetHookSettings(projectKey, repositorySlug, hookKey string) (HookSettings, error)
+		SetHookSettings(projectKey, repositorySlug, hookKey string, settings interface{}) (HookSettings, error)
+		ListFiles(projectKey, repositorySlug, filePath, at string) ([]string, error)
+		Browse(projectKey, repositorySlug, filePath, at string) ([]DirectoryEntry, error)
 		CreatePullRequest(projectKey, repositorySlug, title, description, fromRef, toRef string, reviewers []string) (PullRequest, error)
 		DeleteBranch(projectKey, repositorySlug, branchName string) error
+		GetCommits(projectKey, repositorySlug string, options CommitListOptions) ([]Commit, error)
+		GetCommit(projectKey, repositorySlug, commitID string) (Commit, error)
+		GetChanges(projectKey, repositorySlug, from, to string) ([]Change, error)
+		GetDiff(projectKey, repositorySlug, from, to, filePath string) (Diffs, error)
+		CompareChanges(projectKey, repositorySlug, from, to string) ([]Change, error)
+		CompareCommits(projectKey, repositorySlug, from, to string) ([]Commit, error)
+		CompareDiff(projectKey, repositorySlug, from, to, filePath string) (Diffs, error)
+		DeleteBranchWithOptions(projectKey, repositorySlug, branchName string, options DeleteBranchOptions) error
+		DeleteBranches(projectKey, repositorySlug string, branches []Branch, dryRun bool) []BranchDeletionResult
 	}
 
 	Client struct {
@@ -59,17 +137,21 @@ type (
 		Repository    []Repository `json:"values"`
 	}
 
+	// Repository is a repository.  Public is true if anonymous users can read it.
 	Repository struct {
 		ID      int     `json:"id"`
 		Name    string  `json:"name"`
 		Slug    string  `json:"slug"`
 		Project Project `json:"project"`
 		ScmID   string  `json:"scmId"`
+		Public  bool    `json:"public,omitempty"`
 		Links   Links   `json:"links"`
 	}
 
+	// Project is a project.  Public is true if anonymous users can read all of its repositories.
 	Project struct {
-		Key string `json:"key"`
+		Key    string `json:"key"`
+		Public bool   `json:"public,omitempty"`
 	}
 
 	Links struct {
@@ -90,10 +172,80 @@ type (
 	}
 
 	Branch struct {
-		ID              string `json:"id"`
-		DisplayID       string `json:"displayId"`
-		LatestChangeSet string `json:"latestChangeset"`
-		IsDefault       bool   `json:"isDefault"`
+		ID              string         `json:"id"`
+		DisplayID       string         `json:"displayId"`
+		LatestChangeSet string         `json:"latestChangeset"`
+		IsDefault       bool           `json:"isDefault"`
+		Metadata        BranchMetadata `json:"metadata"`
+	}
+
+	// BranchListOptions narrows and orders the branches returned by ListBranches.  The zero value
+	// lists every branch in the server's default order without metadata.
+	BranchListOptions struct {
+		// FilterText limits the result to branches whose name contains the text.
+		FilterText string
+		// OrderBy is BranchOrderAlphabetical or BranchOrderModification.
+		OrderBy BranchOrder
+		// Base is the branch against which ahead/behind counts are computed.
+		Base string
+		// Details asks the server to populate Branch.Metadata.
+		Details bool
+	}
+
+	BranchOrder string
+
+	// BranchMetadata holds the plugin-provided branch details Stash returns when details=true.
+	BranchMetadata struct {
+		AheadBehind         *AheadBehind
+		LatestCommit        *Commit
+		OutgoingPullRequest *PullRequest
+	}
+
+	AheadBehind struct {
+		Ahead  int `json:"ahead"`
+		Behind int `json:"behind"`
+	}
+
+	Commit struct {
+		ID                 string   `json:"id"`
+		DisplayID          string   `json:"displayId"`
+		Author             Person   `json:"author"`
+		AuthorTimestamp    int64    `json:"authorTimestamp"`
+		Committer          Person   `json:"committer"`
+		CommitterTimestamp int64    `json:"committerTimestamp"`
+		Message            string   `json:"message"`
+		Parents            []Commit `json:"parents"`
+	}
+
+	// Person is a commit author or committer.  It need not be a Stash user.
+	Person struct {
+		Name         string `json:"name"`
+		EmailAddress string `json:"emailAddress"`
+	}
+
+	DeleteBranchOptions struct {
+		// DryRun checks whether the branch could be deleted without deleting it.
+		DryRun bool
+		// EndPoint, if set, is the commit the branch is expected to point at.
+		EndPoint string
+	}
+
+	BranchDeletionResult struct {
+		Branch Branch
+		Err    error
+	}
+
+	branchDeletion struct {
+		Name     string `json:"name"`
+		DryRun   bool   `json:"dryRun"`
+		EndPoint string `json:"endPoint,omitempty"`
+	}
+
+	// RawFile is the streamed content of a file.  Size is -1 if the server did not report it.
+	RawFile struct {
+		io.ReadCloser
+		ContentType string
+		Size        int64
 	}
 
 	Tags struct {
@@ -107,12 +259,17 @@ type (
 	}
 
 	BranchRestrictions struct {
+		Page
 		BranchRestriction []BranchRestriction `json:"values"`
 	}
 
 	BranchRestriction struct {
-		Id     int    `json:"id"`
-		Branch Branch `json:"branch"`
+		Id     int      `json:"id"`
+		Type   string   `json:"type"`
+		Value  string   `json:"value"`
+		Branch Branch   `json:"branch"`
+		Users  []User   `json:"users"`
+		Groups []string `json:"groups"`
 	}
 
 	BranchPermission struct {
@@ -138,8 +295,15 @@ type (
 		ToRef       Ref    `json:"toRef"`
 	}
 
+	// Ref is a branch or tag.  Older Stash versions report its head as latestChangeset and newer ones, and
+	// webhook payloads, as latestCommit; LatestCommitID returns whichever is set.
 	Ref struct {
-		DisplayID string `json:"displayId"`
+		ID              string     `json:"id"`
+		DisplayID       string     `json:"displayId"`
+		Type            string     `json:"type,omitempty"`
+		LatestChangeSet string     `json:"latestChangeset"`
+		LatestCommit    string     `json:"latestCommit,omitempty"`
+		Repository      Repository `json:"repository"`
 	}
 
 	errorResponse struct {
@@ -150,8 +314,15 @@ type (
 
 	// Pull Request Types
 
+	// User is a Stash user.  Only Name is sent when a User appears in a request, e.g. as a reviewer.
 	User struct {
-		Name string `json:"name"`
+		Name         string `json:"name"`
+		EmailAddress string `json:"emailAddress,omitempty"`
+		ID           int    `json:"id,omitempty"`
+		DisplayName  string `json:"displayName,omitempty"`
+		Active       bool   `json:"active,omitempty"`
+		Slug         string `json:"slug,omitempty"`
+		Type         string `json:"type,omitempty"`
 	}
 
 	Reviewer struct {
@@ -186,6 +357,18 @@ const (
 	stashPageLimit int = 25
 )
 
+const (
+	BranchOrderAlphabetical BranchOrder = "ALPHABETICAL"
+	BranchOrderModification BranchOrder = "MODIFICATION"
+)
+
+// Keys under which the branch-utils and ref-metadata plugins report branch metadata.
+const (
+	aheadBehindMetadataKey         = "com.atlassian.stash.stash-branch-utils:ahead-behind-metadata-provider"
+	latestChangesetMetadataKey     = "com.atlassian.stash.stash-branch-utils:latest-changeset-metadata"
+	outgoingPullRequestMetadataKey = "com.atlassian.stash.stash-ref-metadata-plugin:outgoing-pull-request-metadata"
+)
+
 var (
 	httpTransport = &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -194,6 +377,10 @@ var (
 
 var (
 	httpClient *http.Client = &http.Client{Timeout: 10 * time.Second, Transport: httpTransport}
+
+	// streamingHttpClient has no overall timeout, so that large downloads are not cut off while the caller
+	// is still reading the body.
+	streamingHttpClient *http.Client = &http.Client{Transport: httpTransport}
 )
 
 func (e errorResponse) Error() string {
@@ -293,6 +480,55 @@ func (client Client) GetRepositories() (map[int]Repository, error) {
 	return repositories, nil
 }
 
+// GetProjectRepositories returns the repositories of a project.
+func (client Client) GetProjectRepositories(projectKey string) ([]Repository, error) {
+	start := 0
+	repositories := make([]Repository, 0)
+	morePages := true
+	for morePages {
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		var data []byte
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos?start=%d&limit=%d", client.baseURL.String(), projectKey, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetProjectRepositories %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Does the project exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Repositories
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, r.Repository...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return repositories, nil
+}
+
 // GetBranches returns a map of branches indexed by branch display name for the given repository.
 func (client Client) GetBranches(projectKey, repositorySlug string) (map[string]Branch, error) {
 	start := 0
@@ -344,6 +580,203 @@ func (client Client) GetBranches(projectKey, repositorySlug string) (map[string]
 	return branches, nil
 }
 
+// ListBranches returns the branches of the given repository in the order the server returns them,
+// optionally filtered, ordered and decorated with metadata as described by options.
+func (client Client) ListBranches(projectKey, repositorySlug string, options BranchListOptions) ([]Branch, error) {
+	start := 0
+	branches := make([]Branch, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := options.values()
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches?%s", client.baseURL.String(), projectKey, repositorySlug, params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.ListBranches %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusBadRequest:
+					reason = "Bad request.  Is orderBy ALPHABETICAL or MODIFICATION?"
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Branches
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		branches = append(branches, r.Branch...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return branches, nil
+}
+
+func (options BranchListOptions) values() url.Values {
+	params := url.Values{}
+	if options.FilterText != "" {
+		params.Set("filterText", options.FilterText)
+	}
+	if options.OrderBy != "" {
+		params.Set("orderBy", string(options.OrderBy))
+	}
+	if options.Base != "" {
+		params.Set("base", qualifiedBranchRef(options.Base))
+	}
+	if options.Details {
+		params.Set("details", "true")
+	}
+	return params
+}
+
+// UnmarshalJSON decodes the metadata map Stash attaches to a branch, picking out the entries this
+// package knows about and ignoring the rest.
+func (m *BranchMetadata) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if v, ok := raw[aheadBehindMetadataKey]; ok {
+		if err := json.Unmarshal(v, &m.AheadBehind); err != nil {
+			return err
+		}
+	}
+	if v, ok := raw[latestChangesetMetadataKey]; ok {
+		if err := json.Unmarshal(v, &m.LatestCommit); err != nil {
+			return err
+		}
+	}
+	if v, ok := raw[outgoingPullRequestMetadataKey]; ok {
+		var outgoing struct {
+			PullRequest *PullRequest `json:"pullRequest"`
+		}
+		if err := json.Unmarshal(v, &outgoing); err != nil {
+			return err
+		}
+		m.OutgoingPullRequest = outgoing.PullRequest
+	}
+	return nil
+}
+
+// LatestCommitID returns the id of the commit at the head of the ref.
+func (ref Ref) LatestCommitID() string {
+	if ref.LatestCommit != "" {
+		return ref.LatestCommit
+	}
+	return ref.LatestChangeSet
+}
+
+// AuthorTime returns the commit's author timestamp, which Stash reports in milliseconds since the epoch.
+func (commit Commit) AuthorTime() time.Time {
+	return millisToTime(commit.AuthorTimestamp)
+}
+
+// CommitterTime returns the commit's committer timestamp.
+func (commit Commit) CommitterTime() time.Time {
+	return millisToTime(commit.CommitterTimestamp)
+}
+
+// GetDefaultBranch returns the default branch for the given repository.
+func (client Client) GetDefaultBranch(projectKey, repositorySlug string) (Branch, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var branch Branch
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches/default", client.baseURL.String(), projectKey, repositorySlug), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetDefaultBranch %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Does the repository exist and have at least one branch?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &branch)
+	}
+
+	return branch, retry.Try(work)
+}
+
+// SetDefaultBranch makes branchName the default branch of the given repository.  branchName may be
+// a short name such as "main" or a fully qualified ref such as "refs/heads/main".
+func (client Client) SetDefaultBranch(projectKey, repositorySlug, branchName string) error {
+	data, err := json.Marshal(struct {
+		ID string `json:"id"`
+	}{ID: qualifiedBranchRef(branchName)})
+	if err != nil {
+		return err
+	}
+
+	work := func() error {
+		req, err := http.NewRequest("PUT", fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches/default", client.baseURL.String(), projectKey, repositorySlug), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.SetDefaultBranch %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-type", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		switch responseCode {
+		case http.StatusNoContent, http.StatusOK:
+			return nil
+		case http.StatusBadRequest:
+			return errorResponse{StatusCode: responseCode, Reason: "Bad request.  Does the branch exist?"}
+		case http.StatusUnauthorized:
+			return errorResponse{StatusCode: responseCode, Reason: "Unauthorized"}
+		case http.StatusNotFound:
+			return errorResponse{StatusCode: responseCode, Reason: "Not found"}
+		default:
+			return errorResponse{StatusCode: responseCode, Reason: "(unhandled reason)"}
+		}
+	}
+	return retry.New(3*time.Second, 3, retry.DefaultBackoffFunc).Try(work)
+}
+
 // GetTags returns a map of tags indexed by tag display name for the given repository.
 func (client Client) GetTags(projectKey, repositorySlug string) (map[string]Tag, error) {
 	start := 0
@@ -439,24 +872,44 @@ func (client Client) GetRepository(projectKey, repositorySlug string) (Repositor
 	return r, retry.Try(work)
 }
 
+// CreateBranchRestriction restricts pushes to branch to the given user.
 func (client Client) CreateBranchRestriction(projectKey, repositorySlug, branch, user string) (BranchRestriction, error) {
-
-	branchPermission := BranchPermission{
+	return client.CreateBranchPermission(projectKey, repositorySlug, BranchPermission{
 		Type:   "BRANCH",
 		Branch: branch,
 		Users:  []string{user},
 		Groups: []string{},
+	})
+}
+
+// CreateBranchPermission creates a branch restriction that lets only the permission's users and groups push.
+func (client Client) CreateBranchPermission(projectKey, repositorySlug string, permission BranchPermission) (BranchRestriction, error) {
+	return client.sendBranchPermission("CreateBranchPermission", "POST", fmt.Sprintf("%s/rest/branch-permissions/1.0/projects/%s/repos/%s/restricted", client.baseURL.String(), projectKey, repositorySlug), permission)
+}
+
+// UpdateBranchRestriction replaces the users and groups of the branch restriction with the given id.
+func (client Client) UpdateBranchRestriction(projectKey, repositorySlug string, id int, permission BranchPermission) (BranchRestriction, error) {
+	return client.sendBranchPermission("UpdateBranchRestriction", "PUT", fmt.Sprintf("%s/rest/branch-permissions/1.0/projects/%s/repos/%s/restricted/%d", client.baseURL.String(), projectKey, repositorySlug, id), permission)
+}
+
+func (client Client) sendBranchPermission(operation, method, restrictionURL string, permission BranchPermission) (BranchRestriction, error) {
+	if permission.Users == nil {
+		permission.Users = []string{}
+	}
+	if permission.Groups == nil {
+		permission.Groups = []string{}
 	}
 
-	data, err := json.Marshal(branchPermission)
+	data, err := json.Marshal(permission)
 	if err != nil {
 		return BranchRestriction{}, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/rest/branch-permissions/1.0/projects/%s/repos/%s/restricted", client.baseURL.String(), projectKey, repositorySlug), bytes.NewReader(data))
+	req, err := http.NewRequest(method, restrictionURL, bytes.NewReader(data))
 	if err != nil {
 		return BranchRestriction{}, err
 	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-type", "application/json")
@@ -470,9 +923,9 @@ func (client Client) CreateBranchRestriction(projectKey, repositorySlug, branch,
 		var reason string = "unknown reason"
 		switch {
 		case responseCode == http.StatusBadRequest:
-			reason = "The branch restriction was not created due to a validation error."
+			reason = "The branch restriction was not saved due to a validation error."
 		case responseCode == http.StatusUnauthorized:
-			reason = "The currently authenticated user has insufficient permissions to create a branch restriction."
+			reason = "The currently authenticated user has insufficient permissions to manage branch restrictions."
 		case responseCode == http.StatusNotFound:
 			reason = "The resource was not found.  Does the project key exist? What about the repo?  The user?  The branch?"
 		case responseCode == http.StatusConflict:
@@ -490,46 +943,59 @@ func (client Client) CreateBranchRestriction(projectKey, repositorySlug, branch,
 	return t, nil
 }
 
+// GetBranchRestrictions returns every branch restriction of the given repository, reading all pages.
 func (client Client) GetBranchRestrictions(projectKey, repositorySlug string) (BranchRestrictions, error) {
-	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
-
+	start := 0
 	var branchRestrictions BranchRestrictions
-	work := func() error {
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/branch-permissions/1.0/projects/%s/repos/%s/restricted", client.baseURL.String(), projectKey, repositorySlug), nil)
-		if err != nil {
-			return err
-		}
-		Log.Printf("stash.GetBranchRestrictions %s\n", req.URL)
-		req.Header.Set("Accept", "application/json")
-		req.SetBasicAuth(client.userName, client.password)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/branch-permissions/1.0/projects/%s/repos/%s/restricted?start=%d&limit=%d", client.baseURL.String(), projectKey, repositorySlug, start, stashPageLimit), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetBranchRestrictions %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
 
-		responseCode, data, err := consumeResponse(req)
-		if err != nil {
-			return err
-		}
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
 
-		if responseCode != http.StatusOK {
-			var reason string = "unhandled reason"
-			switch {
-			case responseCode == http.StatusNotFound:
-				reason = "Not found"
-			case responseCode == http.StatusUnauthorized:
-				reason = "Unauthorized"
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusNotFound:
+					reason = "Not found"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
 			}
-			return errorResponse{StatusCode: responseCode, Reason: reason}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return BranchRestrictions{}, err
 		}
 
-		err = json.Unmarshal(data, &branchRestrictions)
-		if err != nil {
-			return err
+		var r BranchRestrictions
+		if err := json.Unmarshal(data, &r); err != nil {
+			return BranchRestrictions{}, err
 		}
-		return nil
+		branchRestrictions.BranchRestriction = append(branchRestrictions.BranchRestriction, r.BranchRestriction...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
 	}
-
-	return branchRestrictions, retry.Try(work)
+	branchRestrictions.IsLastPage = true
+	branchRestrictions.Size = len(branchRestrictions.BranchRestriction)
+	return branchRestrictions, nil
 }
 
-// GetRepository returns a repository representation for the given Stash Project key and repository slug.
+// DeleteBranchRestriction deletes the branch restriction with the given id.
 func (client Client) DeleteBranchRestriction(projectKey, repositorySlug string, id int) error {
 	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
 
@@ -689,10 +1155,22 @@ func (client Client) CreatePullRequest(projectKey, repositorySlug, title, descri
 	return t, nil
 }
 
+// DeleteBranch deletes the named branch.
 func (client Client) DeleteBranch(projectKey, repositorySlug, branchName string) error {
+	return client.DeleteBranchWithOptions(projectKey, repositorySlug, branchName, DeleteBranchOptions{})
+}
+
+// DeleteBranchWithOptions deletes the named branch.  With options.DryRun set nothing is deleted and a nil
+// error means the deletion would be allowed.  With options.EndPoint set the deletion is refused unless the
+// branch still points at that commit.
+func (client Client) DeleteBranchWithOptions(projectKey, repositorySlug, branchName string, options DeleteBranchOptions) error {
+	data, err := json.Marshal(branchDeletion{Name: qualifiedBranchRef(branchName), DryRun: options.DryRun, EndPoint: options.EndPoint})
+	if err != nil {
+		return err
+	}
+
 	work := func() error {
-		buffer := bytes.NewBufferString((fmt.Sprintf(`{"name":"refs/heads/%s","dryRun":false}`, branchName)))
-		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/rest/branch-utils/1.0/projects/%s/repos/%s/branches", client.baseURL.String(), projectKey, repositorySlug), buffer)
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/rest/branch-utils/1.0/projects/%s/repos/%s/branches", client.baseURL.String(), projectKey, repositorySlug), bytes.NewReader(data))
 		if err != nil {
 			return err
 		}
@@ -708,9 +1186,13 @@ func (client Client) DeleteBranch(projectKey, repositorySlug, branchName string)
 		case http.StatusNoContent:
 			return nil
 		case http.StatusBadRequest:
-			return errorResponse{StatusCode: responseCode, Reason: "Bad Requeest"}
+			return errorResponse{StatusCode: responseCode, Reason: "Bad Request.  Is the branch protected, or has it moved past the expected end point?"}
 		case http.StatusUnauthorized:
 			return errorResponse{StatusCode: responseCode, Reason: "Unauthorized"}
+		case http.StatusNotFound:
+			return errorResponse{StatusCode: responseCode, Reason: "Not found"}
+		case http.StatusConflict:
+			return errorResponse{StatusCode: responseCode, Reason: "The branch has moved past the expected end point."}
 		default:
 			return errorResponse{StatusCode: responseCode, Reason: "(unhandled reason)"}
 		}
@@ -718,12 +1200,30 @@ func (client Client) DeleteBranch(projectKey, repositorySlug, branchName string)
 	return retry.New(3*time.Second, 3, retry.DefaultBackoffFunc).Try(work)
 }
 
-func (client Client) GetRawFile(repositoryProjectKey, repositorySlug, filePath, branch string) ([]byte, error) {
+// DeleteBranches deletes each of the given branches, continuing past failures, and reports the outcome per branch
+// in the order given.  A branch with a LatestChangeSet is only deleted if it still points at that commit, so
+// branches listed with GetBranches or ListBranches are not deleted if they have moved since.
+func (client Client) DeleteBranches(projectKey, repositorySlug string, branches []Branch, dryRun bool) []BranchDeletionResult {
+	results := make([]BranchDeletionResult, 0, len(branches))
+	for _, branch := range branches {
+		name := branch.ID
+		if name == "" {
+			name = branch.DisplayID
+		}
+		err := client.DeleteBranchWithOptions(projectKey, repositorySlug, name, DeleteBranchOptions{DryRun: dryRun, EndPoint: branch.LatestChangeSet})
+		results = append(results, BranchDeletionResult{Branch: branch, Err: err})
+	}
+	return results
+}
+
+// GetRawFile returns the content of the file at filePath at the given branch, tag or commit.  See OpenRawFile
+// to stream large files.
+func (client Client) GetRawFile(repositoryProjectKey, repositorySlug, filePath, at string) ([]byte, error) {
 	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
 
 	var data []byte
 	work := func() error {
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/projects/%s/repos/%s/browse/%s?at=%s&raw", client.baseURL.String(), strings.ToLower(repositoryProjectKey), strings.ToLower(repositorySlug), filePath, branch), nil)
+		req, err := http.NewRequest("GET", client.rawFileURL(repositoryProjectKey, repositorySlug, filePath, at), nil)
 		if err != nil {
 			return err
 		}
@@ -751,6 +1251,55 @@ func (client Client) GetRawFile(repositoryProjectKey, repositorySlug, filePath,
 	return data, retry.Try(work)
 }
 
+// OpenRawFile opens the file at filePath at the given branch, tag or commit for streaming.  at may be a short
+// branch name, a fully qualified ref such as those returned by BranchRef and TagRef, or a commit hash.  The caller
+// must close the returned RawFile.
+func (client Client) OpenRawFile(repositoryProjectKey, repositorySlug, filePath, at string) (RawFile, error) {
+	req, err := http.NewRequest("GET", client.rawFileURL(repositoryProjectKey, repositorySlug, filePath, at), nil)
+	if err != nil {
+		return RawFile{}, err
+	}
+	Log.Printf("stash.OpenRawFile %s\n", req.URL)
+	req.SetBasicAuth(client.userName, client.password)
+
+	response, err := streamingHttpClient.Do(req)
+	if err != nil {
+		return RawFile{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		var reason string = "unhandled reason"
+		switch {
+		case response.StatusCode == http.StatusNotFound:
+			reason = "Not found"
+		case response.StatusCode == http.StatusUnauthorized:
+			reason = "Unauthorized"
+		}
+		return RawFile{}, errorResponse{StatusCode: response.StatusCode, Reason: reason}
+	}
+
+	return RawFile{ReadCloser: response.Body, ContentType: response.Header.Get("Content-Type"), Size: response.ContentLength}, nil
+}
+
+func (client Client) rawFileURL(projectKey, repositorySlug, filePath, at string) string {
+	params := atValues(at)
+	params.Set("raw", "")
+	return fmt.Sprintf("%s/projects/%s/repos/%s/browse%s?%s", client.baseURL.String(), projectKey, repositorySlug, escapeFilePath(filePath), params.Encode())
+}
+
+// BranchRef returns the fully qualified ref of the named branch.
+func BranchRef(branchName string) string {
+	return qualifiedBranchRef(branchName)
+}
+
+// TagRef returns the fully qualified ref of the named tag.
+func TagRef(tagName string) string {
+	if strings.HasPrefix(tagName, "refs/") {
+		return tagName
+	}
+	return "refs/tags/" + tagName
+}
+
 func HasRepository(repositories map[int]Repository, url string) (Repository, bool) {
 	for _, repo := range repositories {
 		for _, clone := range repo.Links.Clones {
@@ -808,6 +1357,31 @@ func consumeResponse(req *http.Request) (rc int, buffer []byte, err error) {
 	}
 }
 
+func millisToTime(millis int64) time.Time {
+	return time.Unix(millis/1000, (millis%1000)*int64(time.Millisecond))
+}
+
+// escapeFilePath escapes each segment of a slash separated repository path for use in a URL path, returning
+// it with a leading slash, or the empty string for an empty path.
+func escapeFilePath(filePath string) string {
+	var escaped string
+	for _, segment := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		if segment != "" {
+			escaped += "/" + url.PathEscape(segment)
+		}
+	}
+	return escaped
+}
+
+// qualifiedBranchRef turns a short branch name into a fully qualified ref.  Names that are already
+// fully qualified are returned unchanged.
+func qualifiedBranchRef(branchName string) string {
+	if strings.HasPrefix(branchName, "refs/") {
+		return branchName
+	}
+	return "refs/heads/" + branchName
+}
+
 // SshUrl extracts the SSH-based URL from the repository metadata.
 func (repo Repository) SshUrl() string {
 	for _, clone := range repo.Links.Clones {
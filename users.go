@@ -0,0 +1,236 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+type (
+	Users struct {
+		Page
+		Users []User `json:"values"`
+	}
+
+	Groups struct {
+		Page
+		Groups []string `json:"values"`
+	}
+
+	// UserListOptions selects the users returned by GetUsers.  The zero value lists every user visible to the
+	// caller.
+	UserListOptions struct {
+		// Filter matches the start of the user name, display name or email address, case-insensitively.
+		Filter string
+		// Group limits the result to members of the named group.
+		Group string
+		// Permission limits the result to users holding the permission, e.g. LICENSED_USER, or with ProjectKey
+		// set, PROJECT_READ.  With RepositorySlug also set it is a repository permission such as REPO_WRITE.
+		Permission     Permission
+		ProjectKey     string
+		RepositorySlug string
+	}
+)
+
+// GetUsers returns the users selected by options, reading as many pages as needed.
+func (client Client) GetUsers(options UserListOptions) ([]User, error) {
+	return client.getUsers("GetUsers", options.values())
+}
+
+// GetUser returns the user with the given slug.  The slug is usually, but not always, the user name; see
+// UnknownUsers to check user names.
+func (client Client) GetUser(userSlug string) (User, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var user User
+	work := func() error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/users/%s", client.baseURL.String(), url.PathEscape(userSlug)), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.GetUser %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, data, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found.  Does the user exist?"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return json.Unmarshal(data, &user)
+	}
+
+	return user, retry.Try(work)
+}
+
+// GetGroups returns the names of the groups matching filter, or of all groups if filter is empty.
+func (client Client) GetGroups(filter string) ([]string, error) {
+	start := 0
+	groups := make([]string, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params := url.Values{}
+			if filter != "" {
+				params.Set("filter", filter)
+			}
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/groups?%s", client.baseURL.String(), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.GetGroups %s\n", req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized.  Listing groups requires the LICENSED_USER permission."
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Groups
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		groups = append(groups, r.Groups...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return groups, nil
+}
+
+// GetGroupMembers returns the users in the given group.
+func (client Client) GetGroupMembers(group string) ([]User, error) {
+	return client.getUsers("GetGroupMembers", UserListOptions{Group: group}.values())
+}
+
+// UnknownUsers returns the names in userNames that do not belong to an active user, in the order given.  Use it to
+// check reviewers before calling CreatePullRequest.
+func UnknownUsers(client Stash, userNames []string) ([]string, error) {
+	unknown := make([]string, 0)
+	for _, name := range userNames {
+		users, err := client.GetUsers(UserListOptions{Filter: name})
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, user := range users {
+			if user.Name == name && user.Active {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown, nil
+}
+
+func (client Client) getUsers(operation string, params url.Values) ([]User, error) {
+	start := 0
+	users := make([]User, 0)
+	morePages := true
+	for morePages {
+		var data []byte
+		retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+		work := func() error {
+			params.Set("start", fmt.Sprintf("%d", start))
+			params.Set("limit", fmt.Sprintf("%d", stashPageLimit))
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/api/1.0/users?%s", client.baseURL.String(), params.Encode()), nil)
+			if err != nil {
+				return err
+			}
+			Log.Printf("stash.%s %s\n", operation, req.URL)
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(client.userName, client.password)
+
+			var responseCode int
+			responseCode, data, err = consumeResponse(req)
+			if err != nil {
+				return err
+			}
+
+			if responseCode != http.StatusOK {
+				var reason string = "unhandled reason"
+				switch {
+				case responseCode == http.StatusBadRequest:
+					reason = "Bad request.  Is the permission filter valid?"
+				case responseCode == http.StatusNotFound:
+					reason = "Not found.  Does the project or repository in the permission filter exist?"
+				case responseCode == http.StatusUnauthorized:
+					reason = "Unauthorized"
+				}
+				return errorResponse{StatusCode: responseCode, Reason: reason}
+			}
+			return nil
+		}
+		if err := retry.Try(work); err != nil {
+			return nil, err
+		}
+
+		var r Users
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		users = append(users, r.Users...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return users, nil
+}
+
+func (options UserListOptions) values() url.Values {
+	params := url.Values{}
+	if options.Filter != "" {
+		params.Set("filter", options.Filter)
+	}
+	if options.Group != "" {
+		params.Set("group", options.Group)
+	}
+	if options.Permission != "" {
+		if options.ProjectKey == "" {
+			params.Set("permission", string(options.Permission))
+		} else {
+			params.Set("permission.1", string(options.Permission))
+			params.Set("permission.1.projectKey", options.ProjectKey)
+			if options.RepositorySlug != "" {
+				params.Set("permission.1.repositorySlug", options.RepositorySlug)
+			}
+		}
+	}
+	return params
+}
@@ -0,0 +1,192 @@
+package stash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const getUserResponse string = `
+{
+	"name": "jcitizen",
+	"emailAddress": "jane@example.com",
+	"id": 101,
+	"displayName": "Jane Citizen",
+	"active": true,
+	"slug": "jcitizen",
+	"type": "NORMAL"
+}
+`
+
+func TestGetUsers(t *testing.T) {
+	calls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/users" {
+			t.Fatalf("GetUsers() URL path expected to be /rest/api/1.0/users but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		params := url.Query()
+		if params.Get("filter") != "j" || params.Get("group") != "developers" {
+			t.Fatalf("Want filter j and group developers but got %s\n", url.RawQuery)
+		}
+		if params.Get("permission.1") != "REPO_WRITE" || params.Get("permission.1.projectKey") != "PROJ" || params.Get("permission.1.repositorySlug") != "slug" {
+			t.Fatalf("Want a repository permission filter but got %s\n", url.RawQuery)
+		}
+		calls++
+		if params.Get("start") == "0" {
+			fmt.Fprintf(w, `{"isLastPage": false, "nextPageStart": 1, "values": [%s]}`, getUserResponse)
+			return
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"name": "jsmith", "slug": "jsmith", "active": false}]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	users, err := stashClient.GetUsers(UserListOptions{Filter: "j", Group: "developers", Permission: "REPO_WRITE", ProjectKey: "PROJ", RepositorySlug: "slug"})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Want 2 pages but got %d\n", calls)
+	}
+	if len(users) != 2 {
+		t.Fatalf("Want 2 users but got %d\n", len(users))
+	}
+	if users[0].DisplayName != "Jane Citizen" || users[0].EmailAddress != "jane@example.com" || !users[0].Active {
+		t.Fatalf("Want Jane Citizen but got %+v\n", users[0])
+	}
+	if users[1].Active {
+		t.Fatalf("Want jsmith inactive\n")
+	}
+}
+
+func TestGetUsersGlobalPermission(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("permission") != "LICENSED_USER" {
+			t.Fatalf("Want permission LICENSED_USER but got %s\n", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": []}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if _, err := stashClient.GetUsers(UserListOptions{Permission: "LICENSED_USER"}); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/users/jcitizen" {
+			t.Fatalf("GetUser() URL path expected to be /rest/api/1.0/users/jcitizen but found %s\n", url.Path)
+		}
+		fmt.Fprint(w, getUserResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	user, err := stashClient.GetUser("jcitizen")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if user.Name != "jcitizen" || user.Slug != "jcitizen" || user.ID != 101 || user.DisplayName != "Jane Citizen" || !user.Active {
+		t.Fatalf("Want jcitizen but got %+v\n", user)
+	}
+}
+
+func TestGetUser404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	_, err := stashClient.GetUser("nobody")
+	if err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+	if !IsRepositoryNotFound(err) {
+		t.Fatalf("Want a not found error but got %v\n", err)
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/groups" {
+			t.Fatalf("GetGroups() URL path expected to be /rest/api/1.0/groups but found %s\n", url.Path)
+		}
+		if url.Query().Get("filter") != "dev" {
+			t.Fatalf("Want filter dev but got %s\n", url.RawQuery)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": ["developers", "devops"]}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	groups, err := stashClient.GetGroups("dev")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(groups) != 2 || groups[0] != "developers" || groups[1] != "devops" {
+		t.Fatalf("Want developers and devops but got %v\n", groups)
+	}
+}
+
+func TestGetGroupMembers(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("group") != "developers" {
+			t.Fatalf("Want group developers but got %s\n", r.URL.RawQuery)
+		}
+		fmt.Fprintf(w, `{"isLastPage": true, "values": [%s]}`, getUserResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	users, err := stashClient.GetGroupMembers("developers")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(users) != 1 || users[0].Name != "jcitizen" {
+		t.Fatalf("Want jcitizen but got %+v\n", users)
+	}
+}
+
+func TestUnknownUsers(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("filter") {
+		case "jcitizen":
+			fmt.Fprintf(w, `{"isLastPage": true, "values": [%s]}`, getUserResponse)
+		case "jcit":
+			// a prefix match is not the named user
+			fmt.Fprintf(w, `{"isLastPage": true, "values": [%s]}`, getUserResponse)
+		case "retired":
+			fmt.Fprint(w, `{"isLastPage": true, "values": [{"name": "retired", "active": false}]}`)
+		default:
+			fmt.Fprint(w, `{"isLastPage": true, "values": []}`)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	unknown, err := UnknownUsers(stashClient, []string{"jcitizen", "jcit", "retired", "ghost"})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(unknown) != 3 || unknown[0] != "jcit" || unknown[1] != "retired" || unknown[2] != "ghost" {
+		t.Fatalf("Want jcit, retired and ghost but got %v\n", unknown)
+	}
+}
@@ -0,0 +1,141 @@
+package stash
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// WaitOptions controls WaitForBuilds.  The zero value waits for every build reported against the commit,
+	// polling every 5 seconds at first and backing off to once a minute.
+	WaitOptions struct {
+		// RequiredKeys, if not empty, are the build keys that must report before the wait ends.  Builds with
+		// other keys are ignored.
+		RequiredKeys []string
+		// PollInterval is the delay before the second poll.  It doubles after each poll up to MaxInterval.
+		PollInterval time.Duration
+		MaxInterval  time.Duration
+	}
+
+	// BuildOutcome is the aggregated state of the builds of a commit.  State is BuildSuccessful when every build
+	// considered succeeded, BuildFailed when any of them failed, and BuildInProgress if the wait was cut short.
+	BuildOutcome struct {
+		CommitID    string
+		State       BuildState
+		Statuses    []BuildStatus
+		FailedKeys  []string
+		MissingKeys []string
+	}
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultMaxInterval  = time.Minute
+)
+
+// WaitForBuilds polls the build statuses of the given commit until no build is in progress and, if
+// options.RequiredKeys is set, every required build has reported.  A failed poll is treated like one with builds
+// still in progress: the wait backs off and polls again.  If ctx is done first, the outcome so far is returned
+// with ctx.Err(), wrapping the error of the last poll if it failed.
+func WaitForBuilds(ctx context.Context, client Stash, commitID string, options WaitOptions) (BuildOutcome, error) {
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	maxInterval := options.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxInterval
+	}
+
+	outcome := BuildOutcome{CommitID: commitID, State: BuildInProgress}
+	var pollErr error
+	for {
+		if ctx.Err() != nil {
+			return outcome, waitError(ctx, pollErr)
+		}
+		statuses, err := client.GetBuildStatuses(commitID)
+		if err != nil {
+			Log.Printf("stash.WaitForBuilds %s: poll failed, retrying: %v\n", commitID, err)
+			pollErr = err
+		} else {
+			pollErr = nil
+			outcome = aggregateBuilds(commitID, statuses, options.RequiredKeys)
+			if outcome.State != BuildInProgress {
+				return outcome, nil
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return outcome, waitError(ctx, pollErr)
+		case <-timer.C:
+		}
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// waitError is the error of a wait cut short by ctx.  errors.Is matches it against ctx.Err().
+func waitError(ctx context.Context, pollErr error) error {
+	if pollErr == nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("%w; last poll failed: %v", ctx.Err(), pollErr)
+}
+
+// WaitForPullRequestBuilds waits for the builds of the latest commit on the pull request's source branch.
+func WaitForPullRequestBuilds(ctx context.Context, client Stash, pullRequest PullRequest, options WaitOptions) (BuildOutcome, error) {
+	commitID := pullRequest.FromRef.LatestCommitID()
+	if commitID == "" {
+		return BuildOutcome{}, fmt.Errorf("pull request %d has no latest commit on its source branch", pullRequest.ID)
+	}
+	return WaitForBuilds(ctx, client, commitID, options)
+}
+
+// aggregateBuilds reduces the statuses of a commit to a single outcome.  Statuses are considered in full only once
+// nothing is in progress and no required key is missing; until then the outcome is BuildInProgress.
+func aggregateBuilds(commitID string, statuses []BuildStatus, requiredKeys []string) BuildOutcome {
+	outcome := BuildOutcome{CommitID: commitID, State: BuildInProgress}
+
+	required := make(map[string]bool, len(requiredKeys))
+	for _, key := range requiredKeys {
+		required[key] = true
+	}
+	seen := make(map[string]bool)
+	inProgress := false
+	for _, status := range statuses {
+		if len(required) > 0 && !required[status.Key] {
+			continue
+		}
+		seen[status.Key] = true
+		outcome.Statuses = append(outcome.Statuses, status)
+		switch status.State {
+		case BuildFailed:
+			outcome.FailedKeys = append(outcome.FailedKeys, status.Key)
+		case BuildInProgress:
+			inProgress = true
+		}
+	}
+	for _, key := range requiredKeys {
+		if !seen[key] {
+			outcome.MissingKeys = append(outcome.MissingKeys, key)
+		}
+	}
+	sort.Strings(outcome.FailedKeys)
+
+	if inProgress || len(outcome.MissingKeys) > 0 || len(outcome.Statuses) == 0 {
+		return outcome
+	}
+	if len(outcome.FailedKeys) > 0 {
+		outcome.State = BuildFailed
+	} else {
+		outcome.State = BuildSuccessful
+	}
+	return outcome
+}
@@ -0,0 +1,194 @@
+package stash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildStatusesPage(statuses ...string) string {
+	return fmt.Sprintf(`{"isLastPage": true, "values": [%s]}`, strings.Join(statuses, ","))
+}
+
+func buildStatusJSON(key string, state BuildState) string {
+	return fmt.Sprintf(`{"key": %q, "state": %q, "url": "https://ci.example.com/%s"}`, key, state, key)
+}
+
+var fastWait = WaitOptions{PollInterval: time.Millisecond, MaxInterval: 4 * time.Millisecond}
+
+func TestWaitForBuilds(t *testing.T) {
+	polls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/build-status/1.0/commits/def0123abcd" {
+			t.Fatalf("Want /rest/build-status/1.0/commits/def0123abcd but found %s\n", r.URL.Path)
+		}
+		polls++
+		switch polls {
+		case 1:
+			fmt.Fprint(w, buildStatusesPage())
+		case 2:
+			fmt.Fprint(w, buildStatusesPage(buildStatusJSON("unit", BuildInProgress)))
+		default:
+			fmt.Fprint(w, buildStatusesPage(buildStatusJSON("unit", BuildSuccessful), buildStatusJSON("lint", BuildSuccessful)))
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	outcome, err := WaitForBuilds(context.Background(), NewClient("u", "p", url), "def0123abcd", fastWait)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if outcome.State != BuildSuccessful || len(outcome.Statuses) != 2 {
+		t.Fatalf("Want 2 successful builds but got %+v\n", outcome)
+	}
+	if polls != 3 {
+		t.Fatalf("Want 3 polls but got %d\n", polls)
+	}
+}
+
+func TestWaitForBuildsFailed(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, buildStatusesPage(buildStatusJSON("unit", BuildFailed), buildStatusJSON("lint", BuildSuccessful), buildStatusJSON("e2e", BuildFailed)))
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	outcome, err := WaitForBuilds(context.Background(), NewClient("u", "p", url), "def0123abcd", fastWait)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if outcome.State != BuildFailed || strings.Join(outcome.FailedKeys, ",") != "e2e,unit" {
+		t.Fatalf("Want e2e and unit failed but got %+v\n", outcome)
+	}
+}
+
+func TestWaitForBuildsRequiredKeys(t *testing.T) {
+	polls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls == 1 {
+			// an unrelated failing build and no required build yet
+			fmt.Fprint(w, buildStatusesPage(buildStatusJSON("nightly", BuildFailed)))
+			return
+		}
+		fmt.Fprint(w, buildStatusesPage(buildStatusJSON("nightly", BuildFailed), buildStatusJSON("unit", BuildSuccessful)))
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	options := fastWait
+	options.RequiredKeys = []string{"unit"}
+	outcome, err := WaitForBuilds(context.Background(), NewClient("u", "p", url), "def0123abcd", options)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if outcome.State != BuildSuccessful || len(outcome.Statuses) != 1 || polls != 2 {
+		t.Fatalf("Want only the unit build considered after 2 polls but got %+v after %d polls\n", outcome, polls)
+	}
+}
+
+func TestWaitForBuildsContext(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, buildStatusesPage(buildStatusJSON("lint", BuildSuccessful)))
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	options := fastWait
+	options.RequiredKeys = []string{"lint", "unit"}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	outcome, err := WaitForBuilds(ctx, NewClient("u", "p", url), "def0123abcd", options)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Want deadline exceeded but got %v\n", err)
+	}
+	if outcome.State != BuildInProgress || strings.Join(outcome.MissingKeys, ",") != "unit" {
+		t.Fatalf("Want unit missing but got %+v\n", outcome)
+	}
+}
+
+func TestWaitForBuildsPollErrors(t *testing.T) {
+	polls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls <= 3 {
+			// one poll's worth of failed attempts
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprint(w, buildStatusesPage(buildStatusJSON("unit", BuildSuccessful)))
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	outcome, err := WaitForBuilds(context.Background(), NewClient("u", "p", url), "def0123abcd", fastWait)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if outcome.State != BuildSuccessful {
+		t.Fatalf("Want a successful build after the failed poll but got %+v\n", outcome)
+	}
+}
+
+func TestWaitForBuildsPollErrorsUntilDeadline(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	outcome, err := WaitForBuilds(ctx, NewClient("u", "p", url), "def0123abcd", fastWait)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("Want deadline exceeded wrapping the 503 but got %v\n", err)
+	}
+	if outcome.State != BuildInProgress {
+		t.Fatalf("Want the wait cut short but got %+v\n", outcome)
+	}
+}
+
+func TestWaitForBuildsCancelled(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no poll with a cancelled context\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WaitForBuilds(ctx, NewClient("u", "p", url), "def0123abcd", fastWait); err != context.Canceled {
+		t.Fatalf("Want context canceled but got %v\n", err)
+	}
+}
+
+func TestWaitForPullRequestBuilds(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/build-status/1.0/commits/aead30bdfe27e176316bb2e2aedd530052730092" {
+			t.Fatalf("Want the pull request's latest commit but found %s\n", r.URL.Path)
+		}
+		fmt.Fprint(w, buildStatusesPage(buildStatusJSON("unit", BuildSuccessful)))
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	pullRequest := PullRequest{ID: 2, FromRef: Ref{ID: "refs/heads/feature/file1", DisplayID: "feature/file1", LatestChangeSet: "aead30bdfe27e176316bb2e2aedd530052730092"}}
+	outcome, err := WaitForPullRequestBuilds(context.Background(), NewClient("u", "p", url), pullRequest, fastWait)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if outcome.State != BuildSuccessful {
+		t.Fatalf("Want successful but got %+v\n", outcome)
+	}
+
+	if _, err := WaitForPullRequestBuilds(context.Background(), NewClient("u", "p", url), PullRequest{ID: 3}, fastWait); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}
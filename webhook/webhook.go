@@ -0,0 +1,379 @@
+// Package webhook receives Stash webhook deliveries.  A Handler checks the X-Hub-Signature of each delivery,
+// decodes its payload according to the X-Event-Key header and calls the callback registered for the event.
+//
+//	handler := &webhook.Handler{
+//		Secret: secret,
+//		RefsChanged: func(event webhook.RefsChangedEvent) error {
+//			for _, change := range event.Changes {
+//				log.Printf("%s %s %s..%s", event.Repository.Slug, change.RefID, change.FromHash, change.ToHash)
+//			}
+//			return nil
+//		},
+//	}
+//	http.Handle("/hooks/stash", handler)
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xoom/stash"
+)
+
+type (
+	// Handler is an http.Handler for webhook deliveries.  Callbacks are optional; deliveries of events without a
+	// callback are acknowledged and dropped.  A callback error is answered with 500 so that Stash records the
+	// delivery as failed.
+	Handler struct {
+		// Secret is the secret configured on the webhook.  If set, deliveries without a valid signature are
+		// rejected with 401.
+		Secret string
+		// MaxBodyBytes limits the size of a delivery.  Zero means 10 MiB.
+		MaxBodyBytes int64
+		// Error receives the error of a failed callback, which is otherwise logged to stash.Log.  The sender only
+		// sees a generic 500 either way.
+		Error func(event Event, err error)
+
+		RefsChanged        func(RefsChangedEvent) error
+		RepositoryModified func(RepositoryModifiedEvent) error
+		RepositoryForked   func(RepositoryForkedEvent) error
+
+		PullRequestOpened         func(PullRequestEvent) error
+		PullRequestFromRefUpdated func(PullRequestEvent) error
+		PullRequestModified       func(PullRequestEvent) error
+		PullRequestMerged         func(PullRequestEvent) error
+		PullRequestDeclined       func(PullRequestEvent) error
+		PullRequestDeleted        func(PullRequestEvent) error
+
+		ReviewerUpdated    func(ReviewersUpdatedEvent) error
+		ReviewerApproved   func(ReviewerEvent) error
+		ReviewerUnapproved func(ReviewerEvent) error
+		ReviewerNeedsWork  func(ReviewerEvent) error
+
+		CommentAdded   func(CommentEvent) error
+		CommentEdited  func(CommentEvent) error
+		CommentDeleted func(CommentEvent) error
+
+		Ping func(Event) error
+
+		// Other receives events without a typed callback above, with their raw payload.
+		Other func(event Event, payload []byte) error
+	}
+
+	// Event holds the fields common to every delivery.  Date is as sent by Stash, e.g.
+	// "2017-09-19T09:58:11+1000"; see Time.
+	Event struct {
+		Key       stash.WebhookEvent `json:"eventKey"`
+		Date      string             `json:"date"`
+		Actor     stash.User         `json:"actor"`
+		RequestID string             `json:"-"`
+	}
+
+	// RefsChangedEvent is sent when branches or tags are pushed, created or deleted.
+	RefsChangedEvent struct {
+		Event
+		Repository stash.Repository `json:"repository"`
+		Changes    []RefChange      `json:"changes"`
+	}
+
+	// RefChange is one ref updated by a push.  FromHash is all zeros for a new ref and ToHash for a deleted one.
+	RefChange struct {
+		Ref      stash.Ref     `json:"ref"`
+		RefID    string        `json:"refId"`
+		FromHash string        `json:"fromHash"`
+		ToHash   string        `json:"toHash"`
+		Type     RefChangeType `json:"type"`
+	}
+
+	RefChangeType string
+
+	// RepositoryModifiedEvent is sent when a repository is renamed or moved.
+	RepositoryModifiedEvent struct {
+		Event
+		Old stash.Repository `json:"old"`
+		New stash.Repository `json:"new"`
+	}
+
+	// RepositoryForkedEvent is sent when a repository is forked.  Repository is the new fork.
+	RepositoryForkedEvent struct {
+		Event
+		Repository stash.Repository `json:"repository"`
+	}
+
+	// PullRequestEvent is sent when a pull request is opened, updated, merged, declined or deleted.
+	// PreviousFromHash is only set for pr:from_ref_updated, and PreviousTitle and PreviousDescription for
+	// pr:modified.
+	PullRequestEvent struct {
+		Event
+		PullRequest         stash.PullRequest `json:"pullRequest"`
+		PreviousFromHash    string            `json:"previousFromHash,omitempty"`
+		PreviousTitle       string            `json:"previousTitle,omitempty"`
+		PreviousDescription string            `json:"previousDescription,omitempty"`
+	}
+
+	// ReviewerEvent is sent when a reviewer approves, unapproves or marks a pull request as needing work.
+	ReviewerEvent struct {
+		Event
+		PullRequest    stash.PullRequest `json:"pullRequest"`
+		Participant    Participant       `json:"participant"`
+		PreviousStatus string            `json:"previousStatus"`
+	}
+
+	// ReviewersUpdatedEvent is sent when reviewers are added to or removed from a pull request.
+	ReviewersUpdatedEvent struct {
+		Event
+		PullRequest      stash.PullRequest `json:"pullRequest"`
+		AddedReviewers   []stash.User      `json:"addedReviewers"`
+		RemovedReviewers []stash.User      `json:"removedReviewers"`
+	}
+
+	// Participant is a user taking part in a pull request.  Status is APPROVED, UNAPPROVED or NEEDS_WORK.
+	Participant struct {
+		User     stash.User `json:"user"`
+		Role     string     `json:"role"`
+		Approved bool       `json:"approved"`
+		Status   string     `json:"status"`
+	}
+
+	// CommentEvent is sent when a pull request comment is added, edited or deleted.  CommentParentID is set for
+	// replies.
+	CommentEvent struct {
+		Event
+		PullRequest     stash.PullRequest `json:"pullRequest"`
+		Comment         Comment           `json:"comment"`
+		CommentParentID int               `json:"commentParentId,omitempty"`
+		PreviousComment string            `json:"previousComment,omitempty"`
+	}
+
+	Comment struct {
+		ID          int        `json:"id"`
+		Version     int        `json:"version"`
+		Text        string     `json:"text"`
+		Author      stash.User `json:"author"`
+		CreatedDate int64      `json:"createdDate"`
+		UpdatedDate int64      `json:"updatedDate"`
+	}
+)
+
+const (
+	RefAdded   RefChangeType = "ADD"
+	RefUpdated RefChangeType = "UPDATE"
+	RefDeleted RefChangeType = "DELETE"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body keyed with the webhook secret.
+	SignatureHeader = "X-Hub-Signature"
+	EventKeyHeader  = "X-Event-Key"
+	RequestIDHeader = "X-Request-Id"
+
+	defaultMaxBodyBytes = 10 << 20
+)
+
+// Time parses the date of the event.
+func (event Event) Time() (time.Time, error) {
+	return time.Parse("2006-01-02T15:04:05-0700", event.Date)
+}
+
+// Sign returns the X-Hub-Signature value for body, as Stash computes it.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is a valid X-Hub-Signature value for body.
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "webhook deliveries must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	maxBodyBytes := h.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "cannot read delivery: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if h.Secret != "" && !VerifySignature(h.Secret, body, r.Header.Get(SignatureHeader)) {
+		http.Error(w, "invalid or missing "+SignatureHeader, http.StatusUnauthorized)
+		return
+	}
+	key := stash.WebhookEvent(r.Header.Get(EventKeyHeader))
+	if key == "" {
+		http.Error(w, "missing "+EventKeyHeader, http.StatusBadRequest)
+		return
+	}
+
+	err = h.dispatch(key, r.Header.Get(RequestIDHeader), body)
+	if err != nil {
+		if _, ok := err.(payloadError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		event := Event{Key: key, RequestID: r.Header.Get(RequestIDHeader)}
+		if h.Error != nil {
+			h.Error(event, err)
+		} else {
+			stash.Log.Printf("webhook: %s delivery %s failed: %v\n", key, event.RequestID, err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// payloadError is a payload that does not decode as its event key says it should.
+type payloadError struct {
+	key stash.WebhookEvent
+	err error
+}
+
+func (e payloadError) Error() string {
+	return fmt.Sprintf("cannot decode %s payload: %v", e.key, e.err)
+}
+
+func (h *Handler) dispatch(key stash.WebhookEvent, requestID string, body []byte) error {
+	decode := func(v interface{}, event *Event) error {
+		if err := json.Unmarshal(body, v); err != nil {
+			return payloadError{key: key, err: err}
+		}
+		event.Key = key
+		event.RequestID = requestID
+		return nil
+	}
+
+	switch {
+	case key == stash.EventRepoRefsChanged && h.RefsChanged != nil:
+		var e RefsChangedEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return h.RefsChanged(e)
+	case key == stash.EventRepoModified && h.RepositoryModified != nil:
+		var e RepositoryModifiedEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return h.RepositoryModified(e)
+	case key == stash.EventRepoForked && h.RepositoryForked != nil:
+		var e RepositoryForkedEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return h.RepositoryForked(e)
+	case key == stash.EventPullRequestReviewerUpdated && h.ReviewerUpdated != nil:
+		var e ReviewersUpdatedEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return h.ReviewerUpdated(e)
+	case key == stash.EventDiagnosticsPing && h.Ping != nil:
+		var e Event
+		if err := decode(&e, &e); err != nil {
+			return err
+		}
+		return h.Ping(e)
+	}
+
+	if callback := h.pullRequestCallback(key); callback != nil {
+		var e PullRequestEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return callback(e)
+	}
+	if callback := h.reviewerCallback(key); callback != nil {
+		var e ReviewerEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return callback(e)
+	}
+	if callback := h.commentCallback(key); callback != nil {
+		var e CommentEvent
+		if err := decode(&e, &e.Event); err != nil {
+			return err
+		}
+		return callback(e)
+	}
+	if h.Other != nil && !h.typed(key) {
+		var e Event
+		if err := decode(&e, &e); err != nil {
+			return err
+		}
+		return h.Other(e, body)
+	}
+	return nil
+}
+
+func (h *Handler) pullRequestCallback(key stash.WebhookEvent) func(PullRequestEvent) error {
+	switch key {
+	case stash.EventPullRequestOpened:
+		return h.PullRequestOpened
+	case stash.EventPullRequestFromRefUpdated:
+		return h.PullRequestFromRefUpdated
+	case stash.EventPullRequestModified:
+		return h.PullRequestModified
+	case stash.EventPullRequestMerged:
+		return h.PullRequestMerged
+	case stash.EventPullRequestDeclined:
+		return h.PullRequestDeclined
+	case stash.EventPullRequestDeleted:
+		return h.PullRequestDeleted
+	}
+	return nil
+}
+
+func (h *Handler) reviewerCallback(key stash.WebhookEvent) func(ReviewerEvent) error {
+	switch key {
+	case stash.EventPullRequestApproved:
+		return h.ReviewerApproved
+	case stash.EventPullRequestUnapproved:
+		return h.ReviewerUnapproved
+	case stash.EventPullRequestNeedsWork:
+		return h.ReviewerNeedsWork
+	}
+	return nil
+}
+
+func (h *Handler) commentCallback(key stash.WebhookEvent) func(CommentEvent) error {
+	switch key {
+	case stash.EventPullRequestCommentAdded:
+		return h.CommentAdded
+	case stash.EventPullRequestCommentEdited:
+		return h.CommentEdited
+	case stash.EventPullRequestCommentDeleted:
+		return h.CommentDeleted
+	}
+	return nil
+}
+
+// typed reports whether key has a typed callback field, set or not.  Such events never go to Other.
+func (h *Handler) typed(key stash.WebhookEvent) bool {
+	switch key {
+	case stash.EventRepoRefsChanged, stash.EventRepoModified, stash.EventRepoForked, stash.EventPullRequestReviewerUpdated, stash.EventDiagnosticsPing,
+		stash.EventPullRequestOpened, stash.EventPullRequestFromRefUpdated, stash.EventPullRequestModified, stash.EventPullRequestMerged, stash.EventPullRequestDeclined, stash.EventPullRequestDeleted,
+		stash.EventPullRequestApproved, stash.EventPullRequestUnapproved, stash.EventPullRequestNeedsWork,
+		stash.EventPullRequestCommentAdded, stash.EventPullRequestCommentEdited, stash.EventPullRequestCommentDeleted:
+		return true
+	}
+	return false
+}
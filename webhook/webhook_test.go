@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xoom/stash"
+)
+
+const refsChangedPayload string = `
+{
+	"eventKey": "repo:refs_changed",
+	"date": "2017-09-19T09:58:11+1000",
+	"actor": {"name": "admin", "emailAddress": "admin@example.com", "id": 1, "displayName": "Administrator", "active": true, "slug": "admin", "type": "NORMAL"},
+	"repository": {"slug": "repository", "id": 84, "name": "repository", "project": {"key": "PROJ", "name": "Project"}},
+	"changes": [
+		{
+			"ref": {"id": "refs/heads/master", "displayId": "master", "type": "BRANCH"},
+			"refId": "refs/heads/master",
+			"fromHash": "ecddabb624f6f5ba43816f5926e580a5f680a932",
+			"toHash": "178864a7d521b6f5e720b386b2c2b0ef8563e0dc",
+			"type": "UPDATE"
+		}
+	]
+}
+`
+
+const pullRequestPayload string = `
+{
+	"eventKey": "pr:from_ref_updated",
+	"date": "2017-09-19T11:16:17+1000",
+	"actor": {"name": "admin", "slug": "admin"},
+	"pullRequest": {
+		"id": 2,
+		"version": 16,
+		"title": "a new file added",
+		"state": "OPEN",
+		"fromRef": {"id": "refs/heads/a-branch", "displayId": "a-branch", "latestCommit": "5a705e60111a4213da7739c4bcdd1a3a3bb3b1e9", "repository": {"slug": "repository", "project": {"key": "PROJ"}}},
+		"toRef": {"id": "refs/heads/master", "displayId": "master", "latestCommit": "860c4eb4ed0f969b47f3c1e3ba1b37a4a47e7a9a", "repository": {"slug": "repository", "project": {"key": "PROJ"}}}
+	},
+	"previousFromHash": "99f3ea32043ba3ecaa28de6046b2ff3c1f9b4ea3"
+}
+`
+
+const approvedPayload string = `
+{
+	"eventKey": "pr:reviewer:approved",
+	"date": "2017-09-19T11:14:43+1000",
+	"actor": {"name": "user", "slug": "user"},
+	"pullRequest": {"id": 9, "title": "file edited", "state": "OPEN"},
+	"participant": {"user": {"name": "user", "slug": "user"}, "role": "REVIEWER", "approved": true, "status": "APPROVED"},
+	"previousStatus": "UNAPPROVED"
+}
+`
+
+const commentPayload string = `
+{
+	"eventKey": "pr:comment:added",
+	"date": "2017-09-19T11:16:17+1000",
+	"actor": {"name": "admin"},
+	"pullRequest": {"id": 9, "title": "file edited"},
+	"comment": {"id": 62, "version": 0, "text": "I am a PR comment", "author": {"name": "admin"}, "createdDate": 1505784177373, "updatedDate": 1505784177373},
+	"commentParentId": 43
+}
+`
+
+func deliver(handler http.Handler, key, secret, payload string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/hooks/stash", strings.NewReader(payload))
+	if key != "" {
+		r.Header.Set(EventKeyHeader, key)
+	}
+	if secret != "" {
+		r.Header.Set(SignatureHeader, Sign(secret, []byte(payload)))
+	}
+	r.Header.Set(RequestIDHeader, "fbda0e8f-0b5e-4a6f-9ab0-0d5e1f4a4e9a")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRefsChanged(t *testing.T) {
+	var got RefsChangedEvent
+	handler := &Handler{
+		Secret: "s3cret",
+		RefsChanged: func(event RefsChangedEvent) error {
+			got = event
+			return nil
+		},
+	}
+	w := deliver(handler, "repo:refs_changed", "s3cret", refsChangedPayload)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Want 204 but got %d %s\n", w.Code, w.Body)
+	}
+	if got.Key != stash.EventRepoRefsChanged || got.Actor.Slug != "admin" || got.RequestID != "fbda0e8f-0b5e-4a6f-9ab0-0d5e1f4a4e9a" {
+		t.Fatalf("Unexpected event %+v\n", got.Event)
+	}
+	if got.Repository.Slug != "repository" || got.Repository.Project.Key != "PROJ" {
+		t.Fatalf("Unexpected repository %+v\n", got.Repository)
+	}
+	if len(got.Changes) != 1 || got.Changes[0].Type != RefUpdated || got.Changes[0].Ref.DisplayID != "master" || got.Changes[0].ToHash != "178864a7d521b6f5e720b386b2c2b0ef8563e0dc" {
+		t.Fatalf("Unexpected changes %+v\n", got.Changes)
+	}
+	when, err := got.Time()
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if when.UTC().Hour() != 23 {
+		t.Fatalf("Want 23:58 UTC but got %v\n", when.UTC())
+	}
+}
+
+func TestPullRequestEvent(t *testing.T) {
+	var got PullRequestEvent
+	handler := &Handler{
+		PullRequestFromRefUpdated: func(event PullRequestEvent) error {
+			got = event
+			return nil
+		},
+	}
+	w := deliver(handler, "pr:from_ref_updated", "", pullRequestPayload)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Want 204 but got %d %s\n", w.Code, w.Body)
+	}
+	if got.PullRequest.ID != 2 || got.PullRequest.FromRef.LatestCommitID() != "5a705e60111a4213da7739c4bcdd1a3a3bb3b1e9" || got.PreviousFromHash != "99f3ea32043ba3ecaa28de6046b2ff3c1f9b4ea3" {
+		t.Fatalf("Unexpected event %+v\n", got)
+	}
+}
+
+func TestReviewerAndCommentEvents(t *testing.T) {
+	var approved ReviewerEvent
+	var comment CommentEvent
+	handler := &Handler{
+		ReviewerApproved: func(event ReviewerEvent) error {
+			approved = event
+			return nil
+		},
+		CommentAdded: func(event CommentEvent) error {
+			comment = event
+			return nil
+		},
+	}
+	if w := deliver(handler, "pr:reviewer:approved", "", approvedPayload); w.Code != http.StatusNoContent {
+		t.Fatalf("Want 204 but got %d %s\n", w.Code, w.Body)
+	}
+	if !approved.Participant.Approved || approved.Participant.Status != "APPROVED" || approved.PreviousStatus != "UNAPPROVED" || approved.PullRequest.ID != 9 {
+		t.Fatalf("Unexpected event %+v\n", approved)
+	}
+	if w := deliver(handler, "pr:comment:added", "", commentPayload); w.Code != http.StatusNoContent {
+		t.Fatalf("Want 204 but got %d %s\n", w.Code, w.Body)
+	}
+	if comment.Comment.ID != 62 || comment.Comment.Text != "I am a PR comment" || comment.CommentParentID != 43 {
+		t.Fatalf("Unexpected event %+v\n", comment)
+	}
+}
+
+func TestOtherEvents(t *testing.T) {
+	var keys []stash.WebhookEvent
+	handler := &Handler{
+		Other: func(event Event, payload []byte) error {
+			keys = append(keys, event.Key)
+			return nil
+		},
+	}
+	deliver(handler, "mirror:repo_synchronized", "", `{"date": "2017-09-19T11:16:17+1000"}`)
+	deliver(handler, "pr:opened", "", `{"pullRequest": {"id": 1}}`)
+	if len(keys) != 1 || keys[0] != stash.EventMirrorSynchronized {
+		t.Fatalf("Want only the mirror event passed to Other but got %v\n", keys)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	called := false
+	handler := &Handler{
+		Secret: "s3cret",
+		Ping: func(event Event) error {
+			called = true
+			return nil
+		},
+	}
+	var tests = []struct {
+		signature string
+		want      int
+	}{
+		{"", http.StatusUnauthorized},
+		{Sign("wrong", []byte(`{}`)), http.StatusUnauthorized},
+		{strings.TrimPrefix(Sign("s3cret", []byte(`{}`)), "sha256="), http.StatusUnauthorized},
+		{Sign("s3cret", []byte(`{}`)), http.StatusNoContent},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/hooks/stash", strings.NewReader(`{}`))
+		r.Header.Set(EventKeyHeader, "diagnostics:ping")
+		if test.signature != "" {
+			r.Header.Set(SignatureHeader, test.signature)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Fatalf("Want %d for signature %q but got %d\n", test.want, test.signature, w.Code)
+		}
+	}
+	if !called {
+		t.Fatalf("Want the ping callback called for the signed delivery\n")
+	}
+}
+
+func TestBadDeliveries(t *testing.T) {
+	var failed error
+	handler := &Handler{
+		RefsChanged: func(event RefsChangedEvent) error {
+			return errors.New("deploy failed")
+		},
+		Error: func(event Event, err error) {
+			if event.Key != stash.EventRepoRefsChanged {
+				t.Fatalf("Want the failed event key but got %s\n", event.Key)
+			}
+			failed = err
+		},
+	}
+	if w := deliver(handler, "", "", refsChangedPayload); w.Code != http.StatusBadRequest {
+		t.Fatalf("Want 400 without an event key but got %d\n", w.Code)
+	}
+	if w := deliver(handler, "repo:refs_changed", "", `{"changes": 1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Want 400 for a malformed payload but got %d\n", w.Code)
+	}
+	if w := deliver(handler, "repo:refs_changed", "", refsChangedPayload); w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "deploy failed") {
+		t.Fatalf("Want a generic 500 for a callback error but got %d %s\n", w.Code, w.Body)
+	}
+	if failed == nil || failed.Error() != "deploy failed" {
+		t.Fatalf("Want the callback error passed to Error but got %v\n", failed)
+	}
+
+	r := httptest.NewRequest("GET", "/hooks/stash", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Want 405 for GET but got %d\n", w.Code)
+	}
+
+	handler.MaxBodyBytes = 16
+	if w := deliver(handler, "repo:refs_changed", "", refsChangedPayload); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Want 413 for an oversized delivery but got %d\n", w.Code)
+	}
+}
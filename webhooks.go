@@ -0,0 +1,343 @@
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ae6rt/retry"
+)
+
+// Webhooks.  Every method takes a project key and a repository slug; an empty repository slug addresses the
+// webhooks of the project, which fire for all of its repositories.
+
+type (
+	WebhookEvent string
+
+	Webhooks struct {
+		Page
+		Webhooks []Webhook `json:"values"`
+	}
+
+	// Webhook posts the events it subscribes to to URL.  If Configuration.Secret is set, Stash signs each
+	// delivery with an X-Hub-Signature header; the webhook package verifies it and decodes the deliveries.
+	Webhook struct {
+		ID            int                  `json:"id,omitempty"`
+		Name          string               `json:"name"`
+		URL           string               `json:"url"`
+		Events        []WebhookEvent       `json:"events"`
+		Active        bool                 `json:"active"`
+		Configuration WebhookConfiguration `json:"configuration"`
+		CreatedDate   int64                `json:"createdDate,omitempty"`
+		UpdatedDate   int64                `json:"updatedDate,omitempty"`
+	}
+
+	WebhookConfiguration struct {
+		Secret string `json:"secret,omitempty"`
+	}
+
+	// WebhookTestResult is the outcome of a test delivery made by TestWebhook.  Response.StatusCode is zero if
+	// Stash could not connect, in which case Exception says why.
+	WebhookTestResult struct {
+		Request   WebhookTestRequest  `json:"request"`
+		Response  WebhookTestResponse `json:"response"`
+		Exception *WebhookException   `json:"exception"`
+	}
+
+	WebhookTestRequest struct {
+		URL    string `json:"url"`
+		Method string `json:"method"`
+	}
+
+	WebhookTestResponse struct {
+		StatusCode int    `json:"statusCode"`
+		Body       string `json:"body"`
+	}
+
+	WebhookException struct {
+		Message string `json:"message"`
+	}
+
+	// WebhookInvocation is a delivery of an event to a webhook.  Start and Finish are in milliseconds since the
+	// epoch and Duration is in milliseconds.
+	WebhookInvocation struct {
+		ID       int                `json:"id"`
+		Event    WebhookEvent       `json:"event"`
+		Start    int64              `json:"start"`
+		Finish   int64              `json:"finish"`
+		Duration int64              `json:"duration"`
+		Request  WebhookTestRequest `json:"request"`
+		Result   WebhookResult      `json:"result"`
+	}
+
+	WebhookResult struct {
+		Outcome     WebhookOutcome `json:"outcome"`
+		Description string         `json:"description"`
+	}
+
+	WebhookOutcome string
+)
+
+const (
+	EventRepoRefsChanged    WebhookEvent = "repo:refs_changed"
+	EventRepoModified       WebhookEvent = "repo:modified"
+	EventRepoForked         WebhookEvent = "repo:forked"
+	EventRepoCommentAdded   WebhookEvent = "repo:comment:added"
+	EventRepoCommentEdited  WebhookEvent = "repo:comment:edited"
+	EventRepoCommentDeleted WebhookEvent = "repo:comment:deleted"
+	EventMirrorSynchronized WebhookEvent = "mirror:repo_synchronized"
+)
+
+const (
+	EventPullRequestOpened          WebhookEvent = "pr:opened"
+	EventPullRequestFromRefUpdated  WebhookEvent = "pr:from_ref_updated"
+	EventPullRequestModified        WebhookEvent = "pr:modified"
+	EventPullRequestReviewerUpdated WebhookEvent = "pr:reviewer:updated"
+	EventPullRequestApproved        WebhookEvent = "pr:reviewer:approved"
+	EventPullRequestUnapproved      WebhookEvent = "pr:reviewer:unapproved"
+	EventPullRequestNeedsWork       WebhookEvent = "pr:reviewer:needs_work"
+	EventPullRequestMerged          WebhookEvent = "pr:merged"
+	EventPullRequestDeclined        WebhookEvent = "pr:declined"
+	EventPullRequestDeleted         WebhookEvent = "pr:deleted"
+	EventPullRequestCommentAdded    WebhookEvent = "pr:comment:added"
+	EventPullRequestCommentEdited   WebhookEvent = "pr:comment:edited"
+	EventPullRequestCommentDeleted  WebhookEvent = "pr:comment:deleted"
+	EventDiagnosticsPing            WebhookEvent = "diagnostics:ping"
+)
+
+const (
+	WebhookSuccess WebhookOutcome = "SUCCESS"
+	WebhookFailure WebhookOutcome = "FAILURE"
+	WebhookError   WebhookOutcome = "ERROR"
+)
+
+// CreateWebhook creates a webhook.
+func (client Client) CreateWebhook(projectKey, repositorySlug string, webhook Webhook) (Webhook, error) {
+	return client.sendWebhook("CreateWebhook", "POST", client.webhooksURL(projectKey, repositorySlug), webhook)
+}
+
+// UpdateWebhook replaces the webhook with the given id.
+func (client Client) UpdateWebhook(projectKey, repositorySlug string, id int, webhook Webhook) (Webhook, error) {
+	return client.sendWebhook("UpdateWebhook", "PUT", fmt.Sprintf("%s/%d", client.webhooksURL(projectKey, repositorySlug), id), webhook)
+}
+
+func (client Client) sendWebhook(operation, method, webhookURL string, webhook Webhook) (Webhook, error) {
+	if webhook.Name == "" || webhook.URL == "" {
+		return Webhook{}, fmt.Errorf("stash: a webhook needs a name and a URL")
+	}
+	if len(webhook.Events) == 0 {
+		return Webhook{}, fmt.Errorf("stash: webhook %s needs at least one event", webhook.Name)
+	}
+	webhook.ID = 0
+	webhook.CreatedDate = 0
+	webhook.UpdatedDate = 0
+
+	data, err := json.Marshal(webhook)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	req, err := http.NewRequest(method, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return Webhook{}, err
+	}
+	Log.Printf("stash.%s %s\n", operation, req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-type", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if responseCode != http.StatusOK && responseCode != http.StatusCreated {
+		var reason string = "unknown reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "The webhook was not saved due to a validation error."
+		case responseCode == http.StatusUnauthorized:
+			reason = "The currently authenticated user has insufficient permissions to manage webhooks."
+		case responseCode == http.StatusNotFound:
+			reason = "The resource was not found.  Does the project key exist? What about the repo?  The webhook?"
+		case responseCode == http.StatusConflict:
+			reason = "A webhook with that name already exists."
+		}
+		if message := serverMessage(data); message != "" {
+			reason = reason + "  " + message
+		}
+		return Webhook{}, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+
+	var t Webhook
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Webhook{}, err
+	}
+	return t, nil
+}
+
+// GetWebhook returns the webhook with the given id.
+func (client Client) GetWebhook(projectKey, repositorySlug string, id int) (Webhook, error) {
+	data, err := client.getWebhookResource("GetWebhook", fmt.Sprintf("%s/%d", client.webhooksURL(projectKey, repositorySlug), id))
+	if err != nil {
+		return Webhook{}, err
+	}
+	var webhook Webhook
+	if err := json.Unmarshal(data, &webhook); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// GetWebhooks returns the webhooks of the repository, or of the project if repositorySlug is empty.
+func (client Client) GetWebhooks(projectKey, repositorySlug string) ([]Webhook, error) {
+	start := 0
+	webhooks := make([]Webhook, 0)
+	morePages := true
+	for morePages {
+		data, err := client.getWebhookResource("GetWebhooks", fmt.Sprintf("%s?start=%d&limit=%d", client.webhooksURL(projectKey, repositorySlug), start, stashPageLimit))
+		if err != nil {
+			return nil, err
+		}
+
+		var r Webhooks
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, r.Webhooks...)
+		morePages = !r.IsLastPage
+		start = r.NextPageStart
+	}
+	return webhooks, nil
+}
+
+// GetLatestWebhookInvocation returns the most recent delivery of the webhook with the given id.  The invocation has
+// a zero ID if the webhook has not fired yet.
+func (client Client) GetLatestWebhookInvocation(projectKey, repositorySlug string, id int) (WebhookInvocation, error) {
+	data, err := client.getWebhookResource("GetLatestWebhookInvocation", fmt.Sprintf("%s/%d/latest", client.webhooksURL(projectKey, repositorySlug), id))
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return WebhookInvocation{}, err
+	}
+	var invocation WebhookInvocation
+	if err := json.Unmarshal(data, &invocation); err != nil {
+		return WebhookInvocation{}, err
+	}
+	return invocation, nil
+}
+
+// TestWebhook asks Stash to make a test delivery to webhookURL and reports how the endpoint responded.  The
+// webhook need not exist yet, so this can check a URL before calling CreateWebhook.
+func (client Client) TestWebhook(projectKey, repositorySlug, webhookURL string) (WebhookTestResult, error) {
+	params := url.Values{}
+	params.Set("url", webhookURL)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/test?%s", client.webhooksURL(projectKey, repositorySlug), params.Encode()), nil)
+	if err != nil {
+		return WebhookTestResult{}, err
+	}
+	Log.Printf("stash.TestWebhook %s\n", req.URL)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(client.userName, client.password)
+
+	responseCode, data, err := consumeResponse(req)
+	if err != nil {
+		return WebhookTestResult{}, err
+	}
+	if responseCode != http.StatusOK {
+		var reason string = "unhandled reason"
+		switch {
+		case responseCode == http.StatusBadRequest:
+			reason = "Bad request.  Is the URL valid?"
+		case responseCode == http.StatusNotFound:
+			reason = "Not found"
+		case responseCode == http.StatusUnauthorized:
+			reason = "Unauthorized"
+		}
+		return WebhookTestResult{}, errorResponse{StatusCode: responseCode, Reason: reason}
+	}
+
+	var result WebhookTestResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return WebhookTestResult{}, err
+	}
+	return result, nil
+}
+
+// DeleteWebhook deletes the webhook with the given id.
+func (client Client) DeleteWebhook(projectKey, repositorySlug string, id int) error {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	work := func() error {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%d", client.webhooksURL(projectKey, repositorySlug), id), nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.DeleteWebhook %s\n", req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		responseCode, _, err := consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusNoContent {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+
+		return nil
+	}
+
+	return retry.Try(work)
+}
+
+// getWebhookResource GETs a webhook resource, retrying on failure.  A 204 response yields an empty body.
+func (client Client) getWebhookResource(operation, resourceURL string) ([]byte, error) {
+	retry := retry.New(3*time.Second, 3, retry.DefaultBackoffFunc)
+
+	var data []byte
+	work := func() error {
+		req, err := http.NewRequest("GET", resourceURL, nil)
+		if err != nil {
+			return err
+		}
+		Log.Printf("stash.%s %s\n", operation, req.URL)
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(client.userName, client.password)
+
+		var responseCode int
+		responseCode, data, err = consumeResponse(req)
+		if err != nil {
+			return err
+		}
+
+		if responseCode != http.StatusOK && responseCode != http.StatusNoContent {
+			var reason string = "unhandled reason"
+			switch {
+			case responseCode == http.StatusNotFound:
+				reason = "Not found"
+			case responseCode == http.StatusUnauthorized:
+				reason = "Unauthorized"
+			}
+			return errorResponse{StatusCode: responseCode, Reason: reason}
+		}
+		return nil
+	}
+
+	return data, retry.Try(work)
+}
+
+func (client Client) webhooksURL(projectKey, repositorySlug string) string {
+	if repositorySlug == "" {
+		return fmt.Sprintf("%s/rest/api/1.0/projects/%s/webhooks", client.baseURL.String(), projectKey)
+	}
+	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/webhooks", client.baseURL.String(), projectKey, repositorySlug)
+}
@@ -0,0 +1,238 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const webhookResponse string = `
+{
+	"id": 10,
+	"name": "deployer",
+	"createdDate": 1420070400000,
+	"updatedDate": 1420070400000,
+	"events": ["repo:refs_changed", "pr:merged"],
+	"configuration": {"secret": "s3cret"},
+	"url": "https://deployer.example.com/hooks/stash",
+	"active": true
+}
+`
+
+func TestCreateWebhook(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		url := *r.URL
+		if url.Path != "/rest/api/1.0/projects/PROJ/repos/slug/webhooks" {
+			t.Fatalf("CreateWebhook() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/webhooks but found %s\n", url.Path)
+		}
+		if r.Header.Get("Authorization") != "Basic dTpw" {
+			t.Fatalf("Want Basic dTpw but found %s\n", r.Header.Get("Authorization"))
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		want := `{"name":"deployer","url":"https://deployer.example.com/hooks/stash","events":["repo:refs_changed","pr:merged"],"active":true,"configuration":{"secret":"s3cret"}}`
+		if string(data) != want {
+			t.Fatalf("Unexpected request body\n %s\n expected\n %s\n", data, want)
+		}
+		w.WriteHeader(201)
+		fmt.Fprint(w, webhookResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	webhook, err := stashClient.CreateWebhook("PROJ", "slug", Webhook{
+		Name:          "deployer",
+		URL:           "https://deployer.example.com/hooks/stash",
+		Events:        []WebhookEvent{EventRepoRefsChanged, EventPullRequestMerged},
+		Active:        true,
+		Configuration: WebhookConfiguration{Secret: "s3cret"},
+	})
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if webhook.ID != 10 || len(webhook.Events) != 2 || webhook.Events[1] != EventPullRequestMerged {
+		t.Fatalf("Unexpected webhook %+v\n", webhook)
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Want no request for an invalid webhook\n")
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	for _, webhook := range []Webhook{
+		{URL: "https://example.com", Events: []WebhookEvent{EventPullRequestOpened}},
+		{Name: "n", Events: []WebhookEvent{EventPullRequestOpened}},
+		{Name: "n", URL: "https://example.com"},
+	} {
+		if _, err := stashClient.CreateWebhook("PROJ", "", webhook); err == nil {
+			t.Fatalf("Expecting error for %+v but did not get one\n", webhook)
+		}
+	}
+}
+
+func TestUpdateWebhook(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Fatalf("wanted PUT but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/api/1.0/projects/PROJ/webhooks/10" {
+			t.Fatalf("UpdateWebhook() URL path expected to be /rest/api/1.0/projects/PROJ/webhooks/10 but found %s\n", r.URL.Path)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if _, ok := body["id"]; ok {
+			t.Fatalf("Want no id in the request body but got %s\n", data)
+		}
+		if body["active"] != false {
+			t.Fatalf("Want the webhook deactivated but got %s\n", data)
+		}
+		fmt.Fprint(w, webhookResponse)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	webhook := Webhook{ID: 10, Name: "deployer", URL: "https://deployer.example.com/hooks/stash", Events: []WebhookEvent{EventRepoRefsChanged}}
+	if _, err := stashClient.UpdateWebhook("PROJ", "", 10, webhook); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestGetWebhooks(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/PROJ/repos/slug/webhooks":
+			fmt.Fprintf(w, `{"isLastPage": true, "values": [%s]}`, webhookResponse)
+		case "/rest/api/1.0/projects/PROJ/repos/slug/webhooks/10":
+			fmt.Fprint(w, webhookResponse)
+		default:
+			t.Fatalf("Unexpected path %s\n", r.URL.Path)
+		}
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	webhooks, err := stashClient.GetWebhooks("PROJ", "slug")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if len(webhooks) != 1 || webhooks[0].Configuration.Secret != "s3cret" {
+		t.Fatalf("Unexpected webhooks %+v\n", webhooks)
+	}
+	webhook, err := stashClient.GetWebhook("PROJ", "slug", 10)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if webhook.Name != "deployer" || !webhook.Active {
+		t.Fatalf("Unexpected webhook %+v\n", webhook)
+	}
+}
+
+func TestGetLatestWebhookInvocation(t *testing.T) {
+	invoked := true
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/1.0/projects/PROJ/repos/slug/webhooks/10/latest" {
+			t.Fatalf("GetLatestWebhookInvocation() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/webhooks/10/latest but found %s\n", r.URL.Path)
+		}
+		if !invoked {
+			w.WriteHeader(204)
+			return
+		}
+		fmt.Fprint(w, `{"id": 99, "event": "pr:merged", "duration": 120, "start": 1420070400000, "finish": 1420070400120,
+			"request": {"url": "https://deployer.example.com/hooks/stash", "method": "POST"},
+			"result": {"description": "500 Internal Server Error", "outcome": "FAILURE"}}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	invocation, err := stashClient.GetLatestWebhookInvocation("PROJ", "slug", 10)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if invocation.ID != 99 || invocation.Event != EventPullRequestMerged || invocation.Result.Outcome != WebhookFailure {
+		t.Fatalf("Unexpected invocation %+v\n", invocation)
+	}
+
+	invoked = false
+	invocation, err = stashClient.GetLatestWebhookInvocation("PROJ", "slug", 10)
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if invocation.ID != 0 {
+		t.Fatalf("Want no invocation but got %+v\n", invocation)
+	}
+}
+
+func TestTestWebhook(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("wanted POST but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/api/1.0/projects/PROJ/repos/slug/webhooks/test" {
+			t.Fatalf("TestWebhook() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/webhooks/test but found %s\n", r.URL.Path)
+		}
+		if r.URL.Query().Get("url") != "https://deployer.example.com/hooks/stash" {
+			t.Fatalf("Want the webhook URL but got %s\n", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"request": {"url": "https://deployer.example.com/hooks/stash", "method": "POST"}, "response": {"statusCode": 200, "body": "ok"}}`)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	result, err := stashClient.TestWebhook("PROJ", "slug", "https://deployer.example.com/hooks/stash")
+	if err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+	if result.Response.StatusCode != 200 || result.Exception != nil {
+		t.Fatalf("Want a successful test but got %+v\n", result)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("wanted DELETE but found %s\n", r.Method)
+		}
+		if r.URL.Path != "/rest/api/1.0/projects/PROJ/repos/slug/webhooks/10" {
+			t.Fatalf("DeleteWebhook() URL path expected to be /rest/api/1.0/projects/PROJ/repos/slug/webhooks/10 but found %s\n", r.URL.Path)
+		}
+		w.WriteHeader(204)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteWebhook("PROJ", "slug", 10); err != nil {
+		t.Fatalf("Not expecting error: %v\n", err)
+	}
+}
+
+func TestDeleteWebhook404(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL)
+	stashClient := NewClient("u", "p", url)
+	if err := stashClient.DeleteWebhook("PROJ", "slug", 10); err == nil {
+		t.Fatalf("Expecting error but did not get one\n")
+	}
+}